@@ -0,0 +1,495 @@
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"fmt"
+	"html"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"go.bbkane.com/warg/command"
+)
+
+// chartSeries is one line (or set of bars) in a chart. Values line up with
+// chart.Labels
+type chartSeries struct {
+	Name   string
+	Values []int
+}
+
+type chart struct {
+	Title string
+	// Labels are periods for time series, otherwise categories
+	Labels []string
+	Series []chartSeries
+	// TimeSeries charts are drawn left to right, others as horizontal bars
+	TimeSeries bool
+}
+
+// chartPeriods maps --period to an SQLite strftime format and the matching Go
+// layout
+var chartPeriods = map[string]struct {
+	SQLFormat string
+	GoLayout  string
+}{
+	"month": {"%Y-%m", "2006-01"},
+	"year":  {"%Y", "2006"},
+}
+
+// periodLabels lists every period from first to last so gaps show as zeros
+func periodLabels(first string, last string, period string) ([]string, error) {
+	layout := chartPeriods[period].GoLayout
+	start, err := time.Parse(layout, first)
+	if err != nil {
+		return nil, fmt.Errorf("can't parse period: %s: %w", first, err)
+	}
+	end, err := time.Parse(layout, last)
+	if err != nil {
+		return nil, fmt.Errorf("can't parse period: %s: %w", last, err)
+	}
+	var labels []string
+	for t := start; !t.After(end); {
+		labels = append(labels, t.Format(layout))
+		if period == "year" {
+			t = t.AddDate(1, 0, 0)
+		} else {
+			t = t.AddDate(0, 1, 0)
+		}
+	}
+	return labels, nil
+}
+
+// starPeriodLabels lists every period from the first star to the last
+func starPeriodLabels(db *sql.DB, period string) ([]string, error) {
+	sqlFormat := chartPeriods[period].SQLFormat
+	var first, last sql.NullString
+	err := db.QueryRow(
+		`SELECT strftime(?, MIN(StarredAt)), strftime(?, MAX(StarredAt)) FROM Repo`,
+		sqlFormat,
+		sqlFormat,
+	).Scan(&first, &last)
+	if err != nil {
+		return nil, fmt.Errorf("error querying star dates: %w", err)
+	}
+	if !first.Valid {
+		return nil, fmt.Errorf("no stars in database. Run `starghaze format --format sqlite` first")
+	}
+	return periodLabels(first.String, last.String, period)
+}
+
+// queryLabelCounts runs a query returning (label, count) rows
+func queryLabelCounts(db *sql.DB, query string, args ...interface{}) ([]string, []int, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error querying: %w", err)
+	}
+	defer rows.Close()
+	var labels []string
+	var counts []int
+	for rows.Next() {
+		var label string
+		var count int
+		err := rows.Scan(&label, &count)
+		if err != nil {
+			return nil, nil, fmt.Errorf("error scanning: %w", err)
+		}
+		labels = append(labels, label)
+		counts = append(counts, count)
+	}
+	err = rows.Err()
+	if err != nil {
+		return nil, nil, fmt.Errorf("error at end of scan: %w", err)
+	}
+	return labels, counts, nil
+}
+
+func chartPerMonthData(ctx command.Context, db *sql.DB) (*chart, error) {
+	labels, err := starPeriodLabels(db, "month")
+	if err != nil {
+		return nil, err
+	}
+	months, counts, err := queryLabelCounts(
+		db,
+		`
+		SELECT strftime('%Y-%m', StarredAt) AS month, COUNT(*)
+		FROM Repo
+		GROUP BY month
+		`,
+	)
+	if err != nil {
+		return nil, err
+	}
+	byMonth := make(map[string]int)
+	for i := range months {
+		byMonth[months[i]] = counts[i]
+	}
+	values := make([]int, len(labels))
+	for i, label := range labels {
+		values[i] = byMonth[label]
+	}
+	return &chart{
+		Title:      "Stars per month",
+		Labels:     labels,
+		Series:     []chartSeries{{Name: "Stars", Values: values}},
+		TimeSeries: true,
+	}, nil
+}
+
+func chartLanguagesData(ctx command.Context, db *sql.DB) (*chart, error) {
+	limit := ctx.Flags["--limit"].(int)
+	languages, counts, err := queryLabelCounts(
+		db,
+		`
+		SELECT l.Name, COUNT(lr.Repo_id) AS Repo_Count
+		FROM Language_Repo lr JOIN Language l ON lr.Language_id = l.id
+		GROUP BY l.id
+		ORDER BY Repo_Count DESC, l.Name
+		LIMIT ?
+		`,
+		limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &chart{
+		Title:  "Top languages by starred repos",
+		Labels: languages,
+		Series: []chartSeries{{Name: "Repos", Values: counts}},
+	}, nil
+}
+
+func chartTopicsOverTimeData(ctx command.Context, db *sql.DB) (*chart, error) {
+	limit := ctx.Flags["--limit"].(int)
+	period := ctx.Flags["--period"].(string)
+
+	labels, err := starPeriodLabels(db, period)
+	if err != nil {
+		return nil, err
+	}
+	labelIndex := make(map[string]int)
+	for i, label := range labels {
+		labelIndex[label] = i
+	}
+
+	topics, _, err := queryLabelCounts(
+		db,
+		`
+		SELECT t.Name, COUNT(rt.Repo_id) AS Repo_Count
+		FROM Repo_Topic rt JOIN Topic t ON rt.Topic_id = t.id
+		GROUP BY t.id
+		ORDER BY Repo_Count DESC, t.Name
+		LIMIT ?
+		`,
+		limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	c := chart{
+		Title:      "Top topics over time",
+		Labels:     labels,
+		TimeSeries: true,
+	}
+	for _, topic := range topics {
+		periods, counts, err := queryLabelCounts(
+			db,
+			`
+			SELECT strftime(?, r.StarredAt) AS period, COUNT(*)
+			FROM Repo r
+			JOIN Repo_Topic rt ON rt.Repo_id = r.id
+			JOIN Topic t ON rt.Topic_id = t.id
+			WHERE t.Name = ?
+			GROUP BY period
+			`,
+			chartPeriods[period].SQLFormat,
+			topic,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("topic %s: %w", topic, err)
+		}
+		values := make([]int, len(labels))
+		for i := range periods {
+			values[labelIndex[periods[i]]] = counts[i]
+		}
+		c.Series = append(c.Series, chartSeries{Name: topic, Values: values})
+	}
+	return &c, nil
+}
+
+// -- terminal rendering
+
+// eighthBlocks draw the fractional end of a bar
+var eighthBlocks = []string{"", "▏", "▎", "▍", "▌", "▋", "▊", "▉"}
+
+// sparkBlocks draw a value from low to high in one character
+var sparkBlocks = []rune("▁▂▃▄▅▆▇█")
+
+func maxValue(c *chart) int {
+	m := 0
+	for _, s := range c.Series {
+		for _, v := range s.Values {
+			if v > m {
+				m = v
+			}
+		}
+	}
+	return m
+}
+
+func padRight(s string, width int) string {
+	return s + strings.Repeat(" ", width-utf8.RuneCountInString(s))
+}
+
+// writeTerminalBars draws one horizontal bar per label
+func writeTerminalBars(w io.Writer, c *chart, width int) error {
+	labelWidth := 0
+	for _, label := range c.Labels {
+		if n := utf8.RuneCountInString(label); n > labelWidth {
+			labelWidth = n
+		}
+	}
+	largest := maxValue(c)
+	var b strings.Builder
+	b.WriteString(c.Title + "\n\n")
+	for i, label := range c.Labels {
+		value := c.Series[0].Values[i]
+		bar := ""
+		if largest > 0 {
+			eighths := int(math.Round(float64(value) / float64(largest) * float64(width) * 8))
+			bar = strings.Repeat("█", eighths/8) + eighthBlocks[eighths%8]
+		}
+		b.WriteString(padRight(label, labelWidth) + " " + bar + " " + strconv.Itoa(value) + "\n")
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// writeTerminalSparklines draws one sparkline per series, each scaled to
+// the largest value in the chart so they can be compared
+func writeTerminalSparklines(w io.Writer, c *chart) error {
+	nameWidth := 0
+	for _, s := range c.Series {
+		if n := utf8.RuneCountInString(s.Name); n > nameWidth {
+			nameWidth = n
+		}
+	}
+	largest := maxValue(c)
+	var b strings.Builder
+	b.WriteString(c.Title + "\n\n")
+	if len(c.Labels) > 0 {
+		b.WriteString(padRight("", nameWidth) + " " + c.Labels[0] + " to " + c.Labels[len(c.Labels)-1] + "\n")
+	}
+	for _, s := range c.Series {
+		total := 0
+		var line strings.Builder
+		for _, v := range s.Values {
+			total += v
+			if v == 0 || largest == 0 {
+				line.WriteRune(' ')
+				continue
+			}
+			line.WriteRune(sparkBlocks[(v*len(sparkBlocks)-1)/largest])
+		}
+		b.WriteString(padRight(s.Name, nameWidth) + " " + line.String() + " " + strconv.Itoa(total) + "\n")
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// -- SVG rendering
+
+const (
+	svgWidth     = 800
+	svgFontSize  = 12
+	svgBarHeight = 20
+)
+
+// svgPalette colors series in order
+var svgPalette = []string{
+	"#4e79a7", "#f28e2b", "#e15759", "#76b7b2", "#59a14f",
+	"#edc948", "#b07aa1", "#ff9da7", "#9c755f", "#bab0ac",
+}
+
+// xLabelStep returns how many labels to skip so about 12 fit on the x axis
+func xLabelStep(numLabels int) int {
+	step := (numLabels + 11) / 12
+	if step < 1 {
+		step = 1
+	}
+	return step
+}
+
+// writeSVG draws vertical bars for a single time series, lines for several,
+// and horizontal bars otherwise
+func writeSVG(w io.Writer, c *chart) error {
+	var b bytes.Buffer
+	largest := maxValue(c)
+	if largest == 0 {
+		largest = 1
+	}
+	text := func(x float64, y float64, anchor string, s string) {
+		fmt.Fprintf(&b, `<text x="%.1f" y="%.1f" text-anchor="%s">%s</text>`+"\n", x, y, anchor, html.EscapeString(s))
+	}
+
+	if !c.TimeSeries {
+		labelWidth := 0
+		for _, label := range c.Labels {
+			if n := utf8.RuneCountInString(label); n > labelWidth {
+				labelWidth = n
+			}
+		}
+		left := float64(labelWidth*svgFontSize*6/10 + 10)
+		top := 40.0
+		plotWidth := svgWidth - left - 60
+		height := int(top) + len(c.Labels)*svgBarHeight + 20
+		fmt.Fprintf(&b, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" font-family="sans-serif" font-size="%d">`+"\n", svgWidth, height, svgFontSize)
+		text(svgWidth/2, 20, "middle", c.Title)
+		for i, label := range c.Labels {
+			value := c.Series[0].Values[i]
+			y := top + float64(i*svgBarHeight)
+			barWidth := float64(value) / float64(largest) * plotWidth
+			fmt.Fprintf(&b, `<rect x="%.1f" y="%.1f" width="%.1f" height="%d" fill="%s"><title>%s: %d</title></rect>`+"\n",
+				left, y+2, barWidth, svgBarHeight-4, svgPalette[0], html.EscapeString(label), value)
+			text(left-5, y+svgBarHeight/2+4, "end", label)
+			text(left+barWidth+5, y+svgBarHeight/2+4, "start", strconv.Itoa(value))
+		}
+		b.WriteString("</svg>\n")
+		_, err := w.Write(b.Bytes())
+		return err
+	}
+
+	left, right, top, bottom := 50.0, 20.0, 40.0, 40.0
+	if len(c.Series) > 1 {
+		// room for the legend
+		right = 160
+	}
+	height := 400
+	plotWidth := svgWidth - left - right
+	plotHeight := float64(height) - top - bottom
+	slot := plotWidth / float64(len(c.Labels))
+	yOf := func(v int) float64 {
+		return top + plotHeight - float64(v)/float64(largest)*plotHeight
+	}
+
+	fmt.Fprintf(&b, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" font-family="sans-serif" font-size="%d">`+"\n", svgWidth, height, svgFontSize)
+	text(svgWidth/2, 20, "middle", c.Title)
+	// y axis: 0, half and max
+	ticks := []int{0, largest}
+	if largest > 1 {
+		ticks = append(ticks, largest/2)
+	}
+	for _, v := range ticks {
+		y := yOf(v)
+		fmt.Fprintf(&b, `<line x1="%.1f" y1="%.1f" x2="%.1f" y2="%.1f" stroke="#ddd"/>`+"\n", left, y, left+plotWidth, y)
+		text(left-5, y+4, "end", strconv.Itoa(v))
+	}
+	step := xLabelStep(len(c.Labels))
+	for i := 0; i < len(c.Labels); i += step {
+		text(left+slot*(float64(i)+0.5), top+plotHeight+16, "middle", c.Labels[i])
+	}
+
+	if len(c.Series) == 1 {
+		for i, label := range c.Labels {
+			value := c.Series[0].Values[i]
+			fmt.Fprintf(&b, `<rect x="%.1f" y="%.1f" width="%.1f" height="%.1f" fill="%s"><title>%s: %d</title></rect>`+"\n",
+				left+slot*float64(i)+slot*0.1, yOf(value), slot*0.8, top+plotHeight-yOf(value), svgPalette[0], html.EscapeString(label), value)
+		}
+	} else {
+		for i, s := range c.Series {
+			color := svgPalette[i%len(svgPalette)]
+			points := make([]string, len(s.Values))
+			for j, v := range s.Values {
+				points[j] = fmt.Sprintf("%.1f,%.1f", left+slot*(float64(j)+0.5), yOf(v))
+			}
+			fmt.Fprintf(&b, `<polyline points="%s" fill="none" stroke="%s" stroke-width="2"><title>%s</title></polyline>`+"\n",
+				strings.Join(points, " "), color, html.EscapeString(s.Name))
+			legendY := top + float64(i*svgBarHeight)
+			fmt.Fprintf(&b, `<rect x="%.1f" y="%.1f" width="12" height="12" fill="%s"/>`+"\n", left+plotWidth+15, legendY, color)
+			text(left+plotWidth+32, legendY+10, "start", s.Name)
+		}
+	}
+	b.WriteString("</svg>\n")
+	_, err := w.Write(b.Bytes())
+	return err
+}
+
+// writeHTML wraps the SVG chart in a standalone page
+func writeHTML(w io.Writer, c *chart) error {
+	var svg bytes.Buffer
+	err := writeSVG(&svg, c)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(
+		w,
+		"<!DOCTYPE html>\n<html>\n<head>\n<meta charset=\"utf-8\">\n<title>%s</title>\n</head>\n<body>\n%s</body>\n</html>\n",
+		html.EscapeString(c.Title),
+		svg.String(),
+	)
+	return err
+}
+
+// chartAction loads a chart and draws it in the terminal, or to --output as
+// SVG or HTML depending on its extension
+func chartAction(load func(command.Context, *sql.DB) (*chart, error)) func(command.Context) error {
+	return func(ctx command.Context) error {
+		dsn := ctx.Flags["--sqlite-dsn"].(string)
+		output, outputExists := ctx.Flags["--output"].(string)
+		width := ctx.Flags["--width"].(int)
+
+		if width < 1 {
+			return fmt.Errorf("--width must be at least 1: %d", width)
+		}
+		var write func(io.Writer, *chart) error
+		if outputExists {
+			switch strings.ToLower(filepath.Ext(output)) {
+			case ".svg":
+				write = writeSVG
+			case ".html", ".htm":
+				write = writeHTML
+			default:
+				return fmt.Errorf("--output must end in .svg or .html: %s", output)
+			}
+		}
+
+		db, err := openSqliteDB(dsn)
+		if err != nil {
+			return err
+		}
+		defer db.Close()
+
+		c, err := load(ctx, db)
+		if err != nil {
+			return err
+		}
+		if len(c.Labels) == 0 || len(c.Series) == 0 {
+			return fmt.Errorf("nothing to chart in %s", dsn)
+		}
+
+		if !outputExists {
+			if len(c.Series) > 1 {
+				return writeTerminalSparklines(os.Stdout, c)
+			}
+			return writeTerminalBars(os.Stdout, c, width)
+		}
+
+		fp, err := os.Create(output)
+		if err != nil {
+			return fmt.Errorf("can't create output: %s: %w", output, err)
+		}
+		defer fp.Close()
+		err = write(fp, c)
+		if err != nil {
+			return fmt.Errorf("can't write chart: %s: %w", output, err)
+		}
+		return nil
+	}
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Magic numbers at the start of compressed files
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+)
+
+// closeFuncs closes everything in order, returning every error
+type closeFuncs []func() error
+
+func (c closeFuncs) Close() error {
+	var errs []error
+	for _, closer := range c {
+		err := closer()
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return joinErrors(errs)
+}
+
+// readCloser closes a decompressor and its file
+type readCloser struct {
+	io.Reader
+	closeFuncs
+}
+
+// writeCloser closes a compressor and its file
+type writeCloser struct {
+	io.Writer
+	closeFuncs
+}
+
+// openInput opens a file, or stdin if path is "-". gzip and zstd input is
+// decompressed, whatever the file is named
+func openInput(path string) (io.ReadCloser, error) {
+	fp := os.Stdin
+	closers := closeFuncs{}
+	if path != "-" {
+		var err error
+		fp, err = os.Open(path)
+		if err != nil {
+			return nil, fmt.Errorf("file open err: %w", err)
+		}
+		closers = append(closers, fp.Close)
+	}
+
+	buf := bufio.NewReader(fp)
+	// Peek errors if the input is shorter than the magic number. That's
+	// fine - it can't be compressed
+	magic, _ := buf.Peek(len(zstdMagic))
+	switch {
+	case bytes.HasPrefix(magic, gzipMagic):
+		zr, err := gzip.NewReader(buf)
+		if err != nil {
+			_ = closers.Close()
+			return nil, fmt.Errorf("gzip open err: %w", err)
+		}
+		return readCloser{zr, append(closeFuncs{zr.Close}, closers...)}, nil
+	case bytes.HasPrefix(magic, zstdMagic):
+		zr, err := zstd.NewReader(buf)
+		if err != nil {
+			_ = closers.Close()
+			return nil, fmt.Errorf("zstd open err: %w", err)
+		}
+		zrClose := func() error {
+			zr.Close()
+			return nil
+		}
+		return readCloser{zr, append(closeFuncs{zrClose}, closers...)}, nil
+	default:
+		return readCloser{buf, closers}, nil
+	}
+}
+
+// compressWriter wraps fp in a gzip or zstd compressor if path ends in .gz
+// or .zst. Closing the result flushes the compressor and closes fp
+func compressWriter(path string, fp *os.File) (io.WriteCloser, error) {
+	switch {
+	case strings.HasSuffix(path, ".gz"):
+		zw := gzip.NewWriter(fp)
+		return writeCloser{zw, closeFuncs{zw.Close, fp.Close}}, nil
+	case strings.HasSuffix(path, ".zst"):
+		zw, err := zstd.NewWriter(fp)
+		if err != nil {
+			fp.Close()
+			return nil, fmt.Errorf("zstd open err: %w", err)
+		}
+		return writeCloser{zw, closeFuncs{zw.Close, fp.Close}}, nil
+	default:
+		return fp, nil
+	}
+}
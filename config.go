@@ -0,0 +1,176 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// configEnvVars maps config file keys to the env vars of the flags they set,
+// in the order the flags list them. Config values are looked up as the last
+// env var, so flags and any real env var still take precedence
+var configEnvVars = map[string][]string{
+	"credentials_file": {"STARGHAZE_GOOGLE_CREDENTIALS_FILE"},
+	"embed_api_key":    {"STARGHAZE_EMBED_API_KEY", "OPENAI_API_KEY"},
+	"embed_model":      {"STARGHAZE_EMBED_MODEL"},
+	"embed_url":        {"STARGHAZE_EMBED_URL"},
+	"github_token":     {"STARGHAZE_GITHUB_TOKEN", "GITHUB_TOKEN"},
+	"include_lists":    {"STARGHAZE_INCLUDE_LISTS"},
+	"include_readmes":  {"STARGHAZE_INCLUDE_READMES"},
+	"sheet_id":         {"STARGHAZE_SHEET_ID"},
+	"sheet_name":       {"STARGHAZE_SHEET_NAME"},
+	"sinks":            {"STARGHAZE_SINKS"},
+	"spreadsheet_id":   {"STARGHAZE_SPREADSHEET_ID"},
+	"sqlite_dsn":       {"STARGHAZE_SQLITE_DSN"},
+	"timezone":         {"STARGHAZE_TIMEZONE"},
+	"zinc_index_name":  {"STARGHAZE_ZINC_INDEX_NAME"},
+	"zinc_password":    {"STARGHAZE_ZINC_PASSWORD"},
+	"zinc_url":         {"STARGHAZE_ZINC_URL"},
+	"zinc_user":        {"STARGHAZE_ZINC_USER"},
+}
+
+// configEnvVar is the env var a config key is looked up as
+func configEnvVar(key string) string {
+	envVars := configEnvVars[key]
+	return envVars[len(envVars)-1]
+}
+
+// configFile is the YAML config. Top level settings apply to every profile,
+// and the selected profile's settings override them
+type configFile struct {
+	DefaultProfile string                            `yaml:"default_profile"`
+	Profiles       map[string]map[string]interface{} `yaml:"profiles"`
+	Settings       map[string]interface{}            `yaml:",inline"`
+}
+
+// configValueString formats a config value like an env var. Lists are
+// joined with commas
+func configValueString(key string, value interface{}) (string, error) {
+	switch value := value.(type) {
+	case string, int, bool, float64:
+		return fmt.Sprint(value), nil
+	case []interface{}:
+		items := make([]string, len(value))
+		for i := range value {
+			item, err := configValueString(key, value[i])
+			if err != nil {
+				return "", err
+			}
+			items[i] = item
+		}
+		return strings.Join(items, ","), nil
+	default:
+		return "", fmt.Errorf("config key %s must be a string, number, bool or list, not %T", key, value)
+	}
+}
+
+// defaultConfigPath is starghaze.yaml in the user config dir
+// ($XDG_CONFIG_HOME/starghaze on Linux)
+func defaultConfigPath() (string, error) {
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("can't find user config dir: %w", err)
+	}
+	return filepath.Join(configDir, "starghaze", "starghaze.yaml"), nil
+}
+
+// argValue returns the value passed to a flag in args. It runs before warg
+// parses args, so it only understands `--flag value`
+func argValue(args []string, name string) (string, bool) {
+	for i := 0; i < len(args)-1; i++ {
+		if args[i] == name {
+			return args[i+1], true
+		}
+	}
+	return "", false
+}
+
+// addConfigSettings formats settings into envSettings, catching typos in
+// config keys
+func addConfigSettings(envSettings map[string]string, settings map[string]interface{}, where string) error {
+	for key, value := range settings {
+		if _, exists := configEnvVars[key]; !exists {
+			known := make([]string, 0, len(configEnvVars))
+			for k := range configEnvVars {
+				known = append(known, k)
+			}
+			sort.Strings(known)
+			return fmt.Errorf("unknown config key in %s: %s. Known keys: %s", where, key, strings.Join(known, ", "))
+		}
+		str, err := configValueString(key, value)
+		if err != nil {
+			return fmt.Errorf("%s: %w", where, err)
+		}
+		envSettings[configEnvVar(key)] = str
+	}
+	return nil
+}
+
+// configLookup reads the config file chosen by --config (or the default path)
+// and returns a lookup func that checks lookupEnv first, then the selected
+// --profile, then top level settings
+func configLookup(args []string, lookupEnv func(string) (string, bool)) (func(string) (string, bool), error) {
+	configPath, configPathExists := argValue(args, "--config")
+	if !configPathExists {
+		configPath, configPathExists = lookupEnv("STARGHAZE_CONFIG")
+	}
+	profile, profileExists := argValue(args, "--profile")
+	if !profileExists {
+		profile, profileExists = lookupEnv("STARGHAZE_PROFILE")
+	}
+
+	if !configPathExists {
+		var err error
+		configPath, err = defaultConfigPath()
+		if err != nil {
+			return nil, err
+		}
+	}
+	b, err := os.ReadFile(configPath)
+	if errors.Is(err, os.ErrNotExist) && !configPathExists {
+		if profileExists {
+			return nil, fmt.Errorf("--profile %s needs a config file: %s", profile, configPath)
+		}
+		return lookupEnv, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("can't read config: %s: %w", configPath, err)
+	}
+
+	var config configFile
+	err = yaml.UnmarshalStrict(b, &config)
+	if err != nil {
+		return nil, fmt.Errorf("can't parse config: %s: %w", configPath, err)
+	}
+	settings := make(map[string]string)
+	err = addConfigSettings(settings, config.Settings, configPath)
+	if err != nil {
+		return nil, err
+	}
+	if !profileExists {
+		profile = config.DefaultProfile
+	}
+	if profile != "" {
+		profileSettings, exists := config.Profiles[profile]
+		if !exists {
+			return nil, fmt.Errorf("no profile named %s in config: %s", profile, configPath)
+		}
+		err = addConfigSettings(settings, profileSettings, configPath+": profile "+profile)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return func(key string) (string, bool) {
+		if value, exists := lookupEnv(key); exists {
+			return value, true
+		}
+		value, exists := settings[key]
+		return value, exists
+	}, nil
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/lestrrat-go/strftime"
+)
+
+// dateFormatRelative is the date format for "3 months ago" style dates
+const dateFormatRelative = "relative"
+
+// dateFormat formats GitHub's UTC dates for output. The zero value prints
+// RFC 3339 in UTC
+type dateFormat struct {
+	// Strftime formats dates. nil means RFC 3339
+	Strftime *strftime.Strftime
+	// Location converts dates before formatting. nil means UTC
+	Location *time.Location
+	// Relative prints dates like "3 months ago" instead of using Strftime
+	Relative bool
+	// Now is the time Relative dates are relative to
+	Now time.Time
+}
+
+func (f *dateFormat) Format(t time.Time) string {
+	if f.Relative {
+		return relativeTime(t, f.Now)
+	}
+	if f.Location != nil {
+		t = t.In(f.Location)
+	}
+	if f.Strftime == nil {
+		return t.Format(time.RFC3339)
+	}
+	return f.Strftime.FormatString(t)
+}
+
+// relativeTime describes t relative to now, like "3 months ago" or "in 2 days"
+func relativeTime(t time.Time, now time.Time) string {
+	d := now.Sub(t)
+	future := d < 0
+	if future {
+		d = -d
+	}
+	units := []struct {
+		name string
+		size time.Duration
+	}{
+		{"year", 365 * 24 * time.Hour},
+		{"month", 30 * 24 * time.Hour},
+		{"week", 7 * 24 * time.Hour},
+		{"day", 24 * time.Hour},
+		{"hour", time.Hour},
+		{"minute", time.Minute},
+	}
+	for _, unit := range units {
+		n := int(d / unit.size)
+		if n < 1 {
+			continue
+		}
+		amount := fmt.Sprintf("%d %s", n, unit.name)
+		if n > 1 {
+			amount += "s"
+		}
+		if future {
+			return "in " + amount
+		}
+		return amount + " ago"
+	}
+	return "just now"
+}
+
+// newDateFormat parses a strftime pattern, or "relative". An empty pattern
+// means RFC 3339
+func newDateFormat(pattern string, location *time.Location, now time.Time) (*dateFormat, error) {
+	f := &dateFormat{
+		Strftime: nil,
+		Location: location,
+		Relative: pattern == dateFormatRelative,
+		Now:      now,
+	}
+	if pattern != "" && !f.Relative {
+		s, err := strftime.New(pattern)
+		if err != nil {
+			return nil, err
+		}
+		f.Strftime = s
+	}
+	return f, nil
+}
+
+// timezoneFromFlags loads --timezone. It returns nil if not passed
+func timezoneFromFlags(flags map[string]interface{}) (*time.Location, error) {
+	timezone, exists := flags["--timezone"].(string)
+	if !exists {
+		return nil, nil
+	}
+	location, err := time.LoadLocation(timezone)
+	if err != nil {
+		return nil, fmt.Errorf("--timezone error: %w", err)
+	}
+	return location, nil
+}
+
+// edgeDateFormats are the formats for each date of a downloaded star. nil
+// formats print GitHub's dates unchanged
+type edgeDateFormats struct {
+	StarredAt *dateFormat
+	PushedAt  *dateFormat
+	UpdatedAt *dateFormat
+}
+
+// apply sets the formats on an edge's dates
+func (f edgeDateFormats) apply(edge *starredRepositoryEdge) {
+	edge.StarredAt.Format = f.StarredAt
+	edge.Node.PushedAt.Format = f.PushedAt
+	edge.Node.UpdatedAt.Format = f.UpdatedAt
+}
+
+// parseDateFormats parses --date-format, the per field --starred-at-format,
+// --pushed-at-format and --updated-at-format overrides, and --timezone
+func parseDateFormats(flags map[string]interface{}) (edgeDateFormats, error) {
+	location, err := timezoneFromFlags(flags)
+	if err != nil {
+		return edgeDateFormats{}, err
+	}
+	now := time.Now()
+	dateFormatStr, _ := flags["--date-format"].(string)
+
+	parse := func(name string) (*dateFormat, error) {
+		pattern, exists := flags[name].(string)
+		if !exists {
+			pattern = dateFormatStr
+		}
+		if pattern == "" && location == nil {
+			return nil, nil
+		}
+		f, err := newDateFormat(pattern, location, now)
+		if err != nil {
+			if exists {
+				return nil, fmt.Errorf("%s error: %w", name, err)
+			}
+			return nil, fmt.Errorf("--date-format error: %w", err)
+		}
+		return f, nil
+	}
+
+	var formats edgeDateFormats
+	formats.StarredAt, err = parse("--starred-at-format")
+	if err != nil {
+		return formats, err
+	}
+	formats.PushedAt, err = parse("--pushed-at-format")
+	if err != nil {
+		return formats, err
+	}
+	formats.UpdatedAt, err = parse("--updated-at-format")
+	if err != nil {
+		return formats, err
+	}
+	return formats, nil
+}
+
+// dateFormatFromFlags parses --date-format and --timezone for commands that
+// print dates. It returns nil if neither was passed
+func dateFormatFromFlags(flags map[string]interface{}) (*dateFormat, error) {
+	location, err := timezoneFromFlags(flags)
+	if err != nil {
+		return nil, err
+	}
+	pattern, exists := flags["--date-format"].(string)
+	if !exists && location == nil {
+		return nil, nil
+	}
+	f, err := newDateFormat(pattern, location, time.Now())
+	if err != nil {
+		return nil, fmt.Errorf("--date-format error: %w", err)
+	}
+	return f, nil
+}
+
+// formatRFC3339 formats an RFC 3339 string with f, returning it unchanged if
+// f is nil or it doesn't parse
+func formatRFC3339(f *dateFormat, datetime string) string {
+	if f == nil {
+		return datetime
+	}
+	t, err := time.Parse(time.RFC3339, datetime)
+	if err != nil {
+		return datetime
+	}
+	return f.Format(t)
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"go.bbkane.com/warg/command"
+	_ "modernc.org/sqlite"
+)
+
+// ftsTokenizers maps the --fts-tokenizer flag choices to the fts5 tokenize
+// argument.
+// https://www.sqlite.org/fts5.html#tokenizers
+var ftsTokenizers = map[string]string{
+	// the fts5 default: case-insensitive unicode word matching
+	"unicode61": "unicode61",
+	// stem english words so "parsing" matches "parser"
+	"porter": "porter unicode61",
+	// index every 3 char sequence so "sql" matches "postgresql"
+	"trigram": "trigram",
+}
+
+// ftsTables maps each full text search table to a function returning its
+// CREATE statement. They must stay in sync with the tables in the migrations.
+var ftsTables = []struct {
+	Name      string
+	CreateSQL func(tokenize string) string
+}{
+	{
+		Name: "Repo_fts",
+		CreateSQL: func(tokenize string) string {
+			return `
+CREATE VIRTUAL TABLE Repo_fts USING fts5(
+    -- indexed fields
+    Description,
+    HomepageURL,
+    Readme,
+    NameWithOwner,
+    -- unindexed fields
+    StarredAt UNINDEXED,
+    PushedAt UNINDEXED,
+    StargazerCount UNINDEXED,
+    UpdatedAt UNINDEXED,
+    -- special args
+    content='Repo',
+    content_rowid='id',
+    tokenize='` + tokenize + `'
+);
+`
+		},
+	},
+	{
+		Name: "RepoAnnotation_fts",
+		CreateSQL: func(tokenize string) string {
+			return `
+CREATE VIRTUAL TABLE RepoAnnotation_fts USING fts5(
+    -- indexed fields
+    Value,
+    -- unindexed fields
+    Name UNINDEXED,
+    -- special args
+    content='RepoAnnotation',
+    content_rowid='id',
+    tokenize='` + tokenize + `'
+);
+`
+		},
+	},
+	{
+		Name: "RepoAlias_fts",
+		CreateSQL: func(tokenize string) string {
+			return `
+CREATE VIRTUAL TABLE RepoAlias_fts USING fts5(
+    -- indexed fields
+    NameWithOwner,
+    -- special args
+    content='RepoAlias',
+    content_rowid='id',
+    tokenize='` + tokenize + `'
+);
+`
+		},
+	},
+}
+
+// currentFTSTokenizer reads the tokenize argument an FTS table was created
+// with. It returns "unicode61" if the table was created without one.
+func currentFTSTokenizer(db *sql.DB, table string) (string, error) {
+	var createSQL string
+	err := db.QueryRow(
+		`SELECT sql FROM sqlite_master WHERE type = 'table' AND name = ?`,
+		table,
+	).Scan(&createSQL)
+	if err != nil {
+		return "", fmt.Errorf("can't read %s schema: %w", table, err)
+	}
+	_, after, found := strings.Cut(createSQL, "tokenize='")
+	if !found {
+		return "unicode61", nil
+	}
+	tokenize, _, _ := strings.Cut(after, "'")
+	for name, t := range ftsTokenizers {
+		if t == tokenize {
+			return name, nil
+		}
+	}
+	return tokenize, nil
+}
+
+// reindexFTS drops the full text search tables and recreates them with the
+// named tokenizer, then rebuilds the indexes from their content tables. The
+// triggers refer to the FTS tables by name, so they keep working against the
+// new tables.
+func reindexFTS(db *sql.DB, tokenizer string) error {
+	tokenize, exists := ftsTokenizers[tokenizer]
+	if !exists {
+		return fmt.Errorf("unknown fts tokenizer: %s", tokenizer)
+	}
+	return withTx(
+		db,
+		func(tx *sql.Tx) error {
+			for _, table := range ftsTables {
+				if _, err := tx.Exec(`DROP TABLE IF EXISTS ` + table.Name); err != nil {
+					return fmt.Errorf("drop %s err: %w", table.Name, err)
+				}
+				if _, err := tx.Exec(table.CreateSQL(tokenize)); err != nil {
+					return fmt.Errorf("create %s err: %w", table.Name, err)
+				}
+				// https://www.sqlite.org/fts5.html#the_rebuild_command
+				if _, err := tx.Exec(`INSERT INTO ` + table.Name + `(` + table.Name + `) VALUES('rebuild')`); err != nil {
+					return fmt.Errorf("rebuild %s err: %w", table.Name, err)
+				}
+			}
+			return nil
+		},
+	)
+}
+
+// ensureFTSTokenizer reindexes the FTS tables if any wasn't created with
+// tokenizer
+func ensureFTSTokenizer(db *sql.DB, tokenizer string) error {
+	for _, table := range ftsTables {
+		current, err := currentFTSTokenizer(db, table.Name)
+		if err != nil {
+			return err
+		}
+		if current != tokenizer {
+			return reindexFTS(db, tokenizer)
+		}
+	}
+	return nil
+}
+
+// openSqliteDB opens dsn with foreign keys enabled and runs pending migrations
+func openSqliteDB(dsn string) (*sql.DB, error) {
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("db open error: %s: %w", dsn, err)
+	}
+
+	// Enable foreign key checks. For historical reasons, SQLite does not check
+	// foreign key constraints by default... which is kinda insane. There's some
+	// overhead on inserts to verify foreign key integrity but it's definitely
+	// worth it.
+	if _, err := db.Exec(`PRAGMA foreign_keys = ON;`); err != nil {
+		return nil, fmt.Errorf("foreign keys pragma: %w", err)
+	}
+	if err := migrate(db, migrationFS); err != nil {
+		return nil, fmt.Errorf("migrate: %w", err)
+	}
+	return db, nil
+}
+
+func dbReindex(ctx command.Context) error {
+	dsn := ctx.Flags["--sqlite-dsn"].(string)
+	tokenizer := ctx.Flags["--fts-tokenizer"].(string)
+
+	db, err := openSqliteDB(dsn)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	previous, err := currentFTSTokenizer(db, "Repo_fts")
+	if err != nil {
+		return err
+	}
+
+	err = reindexFTS(db, tokenizer)
+	if err != nil {
+		return fmt.Errorf("reindex err: %w", err)
+	}
+	fmt.Printf("Reindexed full text search: %s -> %s\n", previous, tokenizer)
+	return nil
+}
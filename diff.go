@@ -0,0 +1,354 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"go.bbkane.com/warg/command"
+)
+
+// sqliteMagic starts every SQLite database file
+var sqliteMagic = []byte("SQLite format 3\x00")
+
+// diffRepo is what diff compares about a starred repo
+type diffRepo struct {
+	ID             string `json:",omitempty"`
+	NameWithOwner  string
+	Description    string
+	StargazerCount int
+	// IsArchived is nil if the snapshot doesn't record it
+	IsArchived *bool `json:",omitempty"`
+}
+
+// repoMove is a repo that was renamed or transferred to another owner
+type repoMove struct {
+	ID          string
+	From        string
+	To          string
+	Transferred bool
+}
+
+// repoChange is a changed field of a repo in both snapshots
+type repoChange struct {
+	NameWithOwner string
+	Field         string
+	Old           interface{}
+	New           interface{}
+}
+
+// starDiff is what changed between two snapshots of stars
+type starDiff struct {
+	Starred   []diffRepo
+	Unstarred []diffRepo
+	Moved     []repoMove
+	Changed   []repoChange
+}
+
+// isSqliteFile reports whether path is a SQLite database rather than a
+// download file
+func isSqliteFile(path string) (bool, error) {
+	if path == "-" {
+		return false, nil
+	}
+	fp, err := os.Open(path)
+	if err != nil {
+		return false, fmt.Errorf("file open err: %w", err)
+	}
+	defer fp.Close()
+	magic := make([]byte, len(sqliteMagic))
+	// short files can't be databases
+	_, err = io.ReadFull(fp, magic)
+	if err != nil {
+		return false, nil
+	}
+	return bytes.Equal(magic, sqliteMagic), nil
+}
+
+// loadDiffRepos reads a snapshot from a download file or a SQLite database
+func loadDiffRepos(path string) ([]diffRepo, error) {
+	isSqlite, err := isSqliteFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if isSqlite {
+		return loadDiffReposSqlite(path)
+	}
+
+	var repos []diffRepo
+	// files without a header can be from before IsArchived was downloaded
+	hasHeader := false
+	onHeader := func(header *downloadHeader) error {
+		hasHeader = header != nil
+		return nil
+	}
+	err = readEdges(path, onHeader, func(edge *starredRepositoryEdge) error {
+		var isArchived *bool
+		if hasHeader {
+			archived := edge.Node.IsArchived
+			isArchived = &archived
+		}
+		repos = append(repos, diffRepo{
+			ID:             edge.Node.ID,
+			NameWithOwner:  edge.Node.NameWithOwner,
+			Description:    edge.Node.Description,
+			StargazerCount: edge.Node.StargazerCount,
+			IsArchived:     isArchived,
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return repos, nil
+}
+
+// loadDiffReposSqlite reads a snapshot from a database written by
+// format --format sqlite. The database doesn't record archived status. It's
+// opened read only and not migrated, so databases from before node IDs are
+// matched by name only
+func loadDiffReposSqlite(dsn string) ([]diffRepo, error) {
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("db open error: %s: %w", dsn, err)
+	}
+	defer db.Close()
+	// query_only is per connection
+	db.SetMaxOpenConns(1)
+	if _, err := db.Exec(`PRAGMA query_only = ON`); err != nil {
+		return nil, fmt.Errorf("query only pragma: %s: %w", dsn, err)
+	}
+
+	var hasNodeID bool
+	err = db.QueryRow(
+		`SELECT COUNT(*) > 0 FROM pragma_table_info('Repo') WHERE name = 'NodeID'`,
+	).Scan(&hasNodeID)
+	if err != nil {
+		return nil, fmt.Errorf("repo columns err: %s: %w", dsn, err)
+	}
+	nodeIDColumn := "NULL"
+	if hasNodeID {
+		nodeIDColumn = "NodeID"
+	}
+
+	rows, err := db.QueryContext(
+		context.Background(),
+		`SELECT `+nodeIDColumn+`, NameWithOwner, Description, StargazerCount FROM Repo`,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("repo select err: %s: %w", dsn, err)
+	}
+	defer rows.Close()
+
+	var repos []diffRepo
+	for rows.Next() {
+		var r diffRepo
+		var nodeID, description sql.NullString
+		err = rows.Scan(&nodeID, &r.NameWithOwner, &description, &r.StargazerCount)
+		if err != nil {
+			return nil, fmt.Errorf("repo scan err: %s: %w", dsn, err)
+		}
+		r.ID = nodeID.String
+		r.Description = description.String
+		repos = append(repos, r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("repo rows err: %s: %w", dsn, err)
+	}
+	return repos, nil
+}
+
+// repoOwner returns the owner half of owner/name
+func repoOwner(nameWithOwner string) string {
+	owner, _, _ := strings.Cut(nameWithOwner, "/")
+	return owner
+}
+
+// diffStars compares two snapshots. Repos are matched by node ID, and repos
+// without one (from older snapshots) by NameWithOwner, so a new repo that took
+// a renamed repo's old name isn't mistaken for it. Star count changes smaller
+// than minStarChange (or zero) aren't reported
+func diffStars(oldRepos []diffRepo, newRepos []diffRepo, minStarChange int) starDiff {
+	oldByID := make(map[string]int)
+	oldByName := make(map[string]int)
+	for i, r := range oldRepos {
+		if r.ID != "" {
+			oldByID[r.ID] = i
+		}
+		oldByName[strings.ToLower(r.NameWithOwner)] = i
+	}
+
+	// empty, not nil, so JSON output has lists
+	diff := starDiff{
+		Starred:   []diffRepo{},
+		Unstarred: []diffRepo{},
+		Moved:     []repoMove{},
+		Changed:   []repoChange{},
+	}
+	matched := make(map[int]bool)
+	for _, n := range newRepos {
+		i, exists := -1, false
+		if n.ID != "" {
+			i, exists = oldByID[n.ID]
+		}
+		if !exists {
+			i, exists = oldByName[strings.ToLower(n.NameWithOwner)]
+			// repos with different IDs are different repos
+			exists = exists && (n.ID == "" || oldRepos[i].ID == "")
+		}
+		if !exists || matched[i] {
+			diff.Starred = append(diff.Starred, n)
+			continue
+		}
+		matched[i] = true
+		o := oldRepos[i]
+
+		if !strings.EqualFold(o.NameWithOwner, n.NameWithOwner) {
+			diff.Moved = append(diff.Moved, repoMove{
+				ID:          n.ID,
+				From:        o.NameWithOwner,
+				To:          n.NameWithOwner,
+				Transferred: !strings.EqualFold(repoOwner(o.NameWithOwner), repoOwner(n.NameWithOwner)),
+			})
+		}
+		starChange := n.StargazerCount - o.StargazerCount
+		if starChange != 0 && (starChange >= minStarChange || -starChange >= minStarChange) {
+			diff.Changed = append(diff.Changed, repoChange{
+				NameWithOwner: n.NameWithOwner,
+				Field:         "StargazerCount",
+				Old:           o.StargazerCount,
+				New:           n.StargazerCount,
+			})
+		}
+		if o.IsArchived != nil && n.IsArchived != nil && *o.IsArchived != *n.IsArchived {
+			diff.Changed = append(diff.Changed, repoChange{
+				NameWithOwner: n.NameWithOwner,
+				Field:         "IsArchived",
+				Old:           *o.IsArchived,
+				New:           *n.IsArchived,
+			})
+		}
+		if strings.TrimSpace(o.Description) != strings.TrimSpace(n.Description) {
+			diff.Changed = append(diff.Changed, repoChange{
+				NameWithOwner: n.NameWithOwner,
+				Field:         "Description",
+				Old:           o.Description,
+				New:           n.Description,
+			})
+		}
+	}
+	for i, o := range oldRepos {
+		if !matched[i] {
+			diff.Unstarred = append(diff.Unstarred, o)
+		}
+	}
+
+	byName := func(repos []diffRepo) {
+		sort.Slice(repos, func(i, j int) bool {
+			return strings.ToLower(repos[i].NameWithOwner) < strings.ToLower(repos[j].NameWithOwner)
+		})
+	}
+	byName(diff.Starred)
+	byName(diff.Unstarred)
+	sort.SliceStable(diff.Moved, func(i, j int) bool {
+		return strings.ToLower(diff.Moved[i].To) < strings.ToLower(diff.Moved[j].To)
+	})
+	sort.SliceStable(diff.Changed, func(i, j int) bool {
+		return strings.ToLower(diff.Changed[i].NameWithOwner) < strings.ToLower(diff.Changed[j].NameWithOwner)
+	})
+	return diff
+}
+
+// printStarDiffText prints a diff for people, like a weekly changelog
+func printStarDiffText(w io.Writer, diff starDiff) error {
+	buf := bufio.NewWriter(w)
+	if len(diff.Starred)+len(diff.Unstarred)+len(diff.Moved)+len(diff.Changed) == 0 {
+		fmt.Fprintln(buf, "No changes")
+		return buf.Flush()
+	}
+	section := func(title string, count int) {
+		if count > 0 {
+			fmt.Fprintf(buf, "%s (%d):\n", title, count)
+		}
+	}
+	printRepos := func(repos []diffRepo) {
+		for _, r := range repos {
+			fmt.Fprintf(buf, "  https://github.com/%s (%d stars)", r.NameWithOwner, r.StargazerCount)
+			if r.Description != "" {
+				fmt.Fprintf(buf, ": %s", truncateChars(r.Description, 100))
+			}
+			fmt.Fprintln(buf)
+		}
+	}
+
+	section("Starred", len(diff.Starred))
+	printRepos(diff.Starred)
+	section("Unstarred", len(diff.Unstarred))
+	printRepos(diff.Unstarred)
+	section("Renamed or transferred", len(diff.Moved))
+	for _, m := range diff.Moved {
+		verb := "renamed"
+		if m.Transferred {
+			verb = "transferred"
+		}
+		fmt.Fprintf(buf, "  %s -> %s (%s)\n", m.From, m.To, verb)
+	}
+	section("Changed", len(diff.Changed))
+	for _, c := range diff.Changed {
+		switch c.Field {
+		case "StargazerCount":
+			fmt.Fprintf(buf, "  %s: stars %d -> %d (%+d)\n", c.NameWithOwner, c.Old, c.New, c.New.(int)-c.Old.(int))
+		case "IsArchived":
+			if c.New.(bool) {
+				fmt.Fprintf(buf, "  %s: archived\n", c.NameWithOwner)
+			} else {
+				fmt.Fprintf(buf, "  %s: unarchived\n", c.NameWithOwner)
+			}
+		default:
+			fmt.Fprintf(buf, "  %s: %s %q -> %q\n", c.NameWithOwner, strings.ToLower(c.Field), c.Old, c.New)
+		}
+	}
+	return buf.Flush()
+}
+
+func diff(ctx command.Context) error {
+	oldPath := ctx.Flags["--old"].(string)
+	newPath := ctx.Flags["--new"].(string)
+	outputFormat := ctx.Flags["--format"].(string)
+	minStarChange := ctx.Flags["--min-star-change"].(int)
+
+	if minStarChange < 0 {
+		return fmt.Errorf("--min-star-change must not be negative: %d", minStarChange)
+	}
+	oldRepos, err := loadDiffRepos(oldPath)
+	if err != nil {
+		return err
+	}
+	newRepos, err := loadDiffRepos(newPath)
+	if err != nil {
+		return err
+	}
+
+	d := diffStars(oldRepos, newRepos, minStarChange)
+	switch outputFormat {
+	case "json":
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(d)
+		if err != nil {
+			return fmt.Errorf("json encode err: %w", err)
+		}
+		return nil
+	case "text":
+		return printStarDiffText(os.Stdout, d)
+	default:
+		return fmt.Errorf("unknown --format: %s", outputFormat)
+	}
+}
@@ -0,0 +1,302 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strings"
+	"time"
+
+	"go.bbkane.com/warg/command"
+	_ "modernc.org/sqlite"
+)
+
+// Embedder turns texts into vectors. Implementations must return one vector
+// per text, in the same order.
+type Embedder interface {
+	Embed(ctx context.Context, texts []string) ([][]float32, error)
+	Model() string
+}
+
+// -- OpenAIEmbedder
+
+// OpenAIEmbedder calls an OpenAI-compatible /embeddings endpoint. Local
+// servers like Ollama and llama.cpp serve the same API.
+type OpenAIEmbedder struct {
+	baseURL string
+	model   string
+	apiKey  string
+	client  *http.Client
+}
+
+func NewOpenAIEmbedder(baseURL string, model string, apiKey string) *OpenAIEmbedder {
+	return &OpenAIEmbedder{
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		model:   model,
+		apiKey:  apiKey,
+		client:  http.DefaultClient,
+	}
+}
+
+func (e *OpenAIEmbedder) Model() string {
+	return e.model
+}
+
+// https://platform.openai.com/docs/api-reference/embeddings
+type openAIEmbeddingRequest struct {
+	Model string   `json:"model"`
+	Input []string `json:"input"`
+}
+
+type openAIEmbeddingResponse struct {
+	Data []struct {
+		Index     int       `json:"index"`
+		Embedding []float32 `json:"embedding"`
+	} `json:"data"`
+}
+
+func (e *OpenAIEmbedder) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	reqBody, err := json.Marshal(openAIEmbeddingRequest{
+		Model: e.model,
+		Input: texts,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("json marshall err: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.baseURL+"/embeddings", bytes.NewReader(reqBody))
+	if err != nil {
+		return nil, fmt.Errorf("request build err: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if e.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+e.apiKey)
+	}
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("embedding request err: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, fmt.Errorf("embedding request status: %d: %s", resp.StatusCode, body)
+	}
+
+	var respBody openAIEmbeddingResponse
+	err = json.NewDecoder(resp.Body).Decode(&respBody)
+	if err != nil {
+		return nil, fmt.Errorf("json decode err: %w", err)
+	}
+	if len(respBody.Data) != len(texts) {
+		return nil, fmt.Errorf("asked for %d embeddings, got %d", len(texts), len(respBody.Data))
+	}
+
+	vecs := make([][]float32, len(texts))
+	for _, d := range respBody.Data {
+		if d.Index < 0 || d.Index >= len(vecs) {
+			return nil, fmt.Errorf("embedding index out of range: %d", d.Index)
+		}
+		vecs[d.Index] = d.Embedding
+	}
+	return vecs, nil
+}
+
+var _ Embedder = new(OpenAIEmbedder)
+
+// -- vector helpers
+
+// encodeVector packs v into little-endian float32s for the Embedding column
+func encodeVector(v []float32) []byte {
+	buf := make([]byte, 4*len(v))
+	for i, f := range v {
+		binary.LittleEndian.PutUint32(buf[4*i:], math.Float32bits(f))
+	}
+	return buf
+}
+
+// decodeVector is the inverse of encodeVector
+func decodeVector(buf []byte) ([]float32, error) {
+	if len(buf)%4 != 0 {
+		return nil, fmt.Errorf("embedding blob length not a multiple of 4: %d", len(buf))
+	}
+	v := make([]float32, len(buf)/4)
+	for i := range v {
+		v[i] = math.Float32frombits(binary.LittleEndian.Uint32(buf[4*i:]))
+	}
+	return v, nil
+}
+
+// cosineSimilarity returns 0 for mismatched or zero vectors
+func cosineSimilarity(a []float32, b []float32) float64 {
+	if len(a) != len(b) {
+		return 0
+	}
+	var dot, normA, normB float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		normA += float64(a[i]) * float64(a[i])
+		normB += float64(b[i]) * float64(b[i])
+	}
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+	return dot / (math.Sqrt(normA) * math.Sqrt(normB))
+}
+
+// embeddingText builds the text we embed for a repo. The README is truncated
+// to maxChars as most models have small context windows
+func embeddingText(nameWithOwner string, description string, readme string, maxChars int) string {
+	text := nameWithOwner + "\n" + description + "\n" + readme
+	if maxChars > 0 && len(text) > maxChars {
+		text = strings.ToValidUTF8(text[:maxChars], "")
+	}
+	return text
+}
+
+func contentHash(text string) string {
+	sum := sha256.Sum256([]byte(text))
+	return hex.EncodeToString(sum[:])
+}
+
+// -- embed command
+
+type repoToEmbed struct {
+	id   int
+	text string
+	hash string
+}
+
+func embedRepos(ctx command.Context) error {
+	dsn := ctx.Flags["--sqlite-dsn"].(string)
+	batchSize := ctx.Flags["--batch-size"].(int)
+	maxInputChars := ctx.Flags["--max-input-chars"].(int)
+	timeout := ctx.Flags["--timeout"].(time.Duration)
+	embedURL := ctx.Flags["--embed-url"].(string)
+	embedModel := ctx.Flags["--embed-model"].(string)
+	embedAPIKey, _ := ctx.Flags["--embed-api-key"].(string)
+
+	if batchSize < 1 {
+		return fmt.Errorf("--batch-size must be positive: %d", batchSize)
+	}
+
+	timeCtx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	db, err := openSqliteDB(dsn)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	var embedder Embedder = NewOpenAIEmbedder(embedURL, embedModel, embedAPIKey)
+
+	// find repos that don't have an up to date embedding for this model
+	rows, err := db.QueryContext(
+		timeCtx,
+		`
+		SELECT
+			r.id,
+			r.NameWithOwner,
+			COALESCE(r.Description, ''),
+			COALESCE(r.Readme, ''),
+			COALESCE(e.ContentHash, '')
+		FROM
+			Repo r
+			LEFT JOIN RepoEmbedding e ON e.Repo_id = r.id AND e.Model = ?
+		`,
+		embedder.Model(),
+	)
+	if err != nil {
+		return fmt.Errorf("error querying repos: %w", err)
+	}
+	var todo []repoToEmbed
+	for rows.Next() {
+		var id int
+		var nameWithOwner, description, readme, oldHash string
+		err := rows.Scan(&id, &nameWithOwner, &description, &readme, &oldHash)
+		if err != nil {
+			rows.Close()
+			return fmt.Errorf("error scanning repo: %w", err)
+		}
+		text := embeddingText(nameWithOwner, description, readme, maxInputChars)
+		hash := contentHash(text)
+		if hash != oldHash {
+			todo = append(todo, repoToEmbed{id: id, text: text, hash: hash})
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error at end of scan: %w", err)
+	}
+
+	embedded := 0
+	for start := 0; start < len(todo); start += batchSize {
+		end := start + batchSize
+		if end > len(todo) {
+			end = len(todo)
+		}
+		batch := todo[start:end]
+
+		texts := make([]string, len(batch))
+		for i := range batch {
+			texts[i] = batch[i].text
+		}
+		vecs, err := embedder.Embed(timeCtx, texts)
+		if err != nil {
+			return fmt.Errorf("embed err after %d repos: %w", embedded, err)
+		}
+
+		// commit each batch so an interrupted run keeps its progress
+		err = withTx(
+			db,
+			func(tx *sql.Tx) error {
+				for i := range batch {
+					_, err := tx.ExecContext(
+						timeCtx,
+						`
+						INSERT INTO RepoEmbedding (
+							Repo_id,
+							Model,
+							ContentHash,
+							Dimensions,
+							Embedding
+						)
+						VALUES (?, ?, ?, ?, ?)
+						ON CONFLICT(Repo_id, Model)
+						DO UPDATE SET
+							ContentHash = excluded.ContentHash,
+							Dimensions = excluded.Dimensions,
+							Embedding = excluded.Embedding
+						`,
+						batch[i].id,
+						embedder.Model(),
+						batch[i].hash,
+						len(vecs[i]),
+						encodeVector(vecs[i]),
+					)
+					if err != nil {
+						return fmt.Errorf("embedding insert err: %w", err)
+					}
+				}
+				return nil
+			},
+		)
+		if err != nil {
+			return err
+		}
+		embedded += len(batch)
+	}
+
+	fmt.Printf("Embedded %d repos with %s\n", embedded, embedder.Model())
+	return nil
+}
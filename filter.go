@@ -0,0 +1,641 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// edgeFilter returns whether an edge should be printed
+type edgeFilter func(sr *starredRepositoryEdge) (bool, error)
+
+// parseFilterTime parses a date (2006-01-02) or RFC 3339 datetime
+func parseFilterTime(s string) (time.Time, error) {
+	t, err := time.Parse("2006-01-02", s)
+	if err == nil {
+		return t, nil
+	}
+	t, err = time.Parse(time.RFC3339, s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("not a date (2006-01-02) or RFC 3339 datetime: %q", s)
+	}
+	return t, nil
+}
+
+// containsFold returns whether list contains s, ignoring case
+func containsFold(list []string, s string) bool {
+	for _, item := range list {
+		if strings.EqualFold(item, s) {
+			return true
+		}
+	}
+	return false
+}
+
+func edgeLanguages(sr *starredRepositoryEdge) []string {
+	languages := make([]string, len(sr.Node.Languages.Edges))
+	for i := range sr.Node.Languages.Edges {
+		languages[i] = sr.Node.Languages.Edges[i].Node.Name
+	}
+	return languages
+}
+
+func edgeTopics(sr *starredRepositoryEdge) []string {
+	topics := make([]string, len(sr.Node.RepositoryTopics.Nodes))
+	for i := range sr.Node.RepositoryTopics.Nodes {
+		topics[i] = sr.Node.RepositoryTopics.Nodes[i].Topic.Name
+	}
+	return topics
+}
+
+// filterFromFlags combines the filter flags passed to format. It returns
+// nil if no filter flags were passed
+func filterFromFlags(flags map[string]interface{}) (edgeFilter, error) {
+	var filters []edgeFilter
+
+	if languages, exists := flags["--language"].([]string); exists {
+		filters = append(filters, func(sr *starredRepositoryEdge) (bool, error) {
+			repoLanguages := edgeLanguages(sr)
+			for _, language := range languages {
+				if containsFold(repoLanguages, language) {
+					return true, nil
+				}
+			}
+			return false, nil
+		})
+	}
+	if topics, exists := flags["--topic"].([]string); exists {
+		filters = append(filters, func(sr *starredRepositoryEdge) (bool, error) {
+			repoTopics := edgeTopics(sr)
+			for _, topic := range topics {
+				if containsFold(repoTopics, topic) {
+					return true, nil
+				}
+			}
+			return false, nil
+		})
+	}
+	for _, bound := range []string{"--starred-after", "--starred-before"} {
+		str, exists := flags[bound].(string)
+		if !exists {
+			continue
+		}
+		t, err := parseFilterTime(str)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", bound, err)
+		}
+		after := bound == "--starred-after"
+		filters = append(filters, func(sr *starredRepositoryEdge) (bool, error) {
+			starredAt, err := sr.StarredAt.Time()
+			if err != nil {
+				return false, fmt.Errorf("StarredAt time err: %w", err)
+			}
+			if after {
+				return starredAt.After(t), nil
+			}
+			return starredAt.Before(t), nil
+		})
+	}
+	if minStars, exists := flags["--min-stars"].(int); exists {
+		filters = append(filters, func(sr *starredRepositoryEdge) (bool, error) {
+			return sr.Node.StargazerCount >= minStars, nil
+		})
+	}
+	if nameRegex, exists := flags["--name-regex"].(string); exists {
+		re, err := regexp.Compile(nameRegex)
+		if err != nil {
+			return nil, fmt.Errorf("--name-regex: %w", err)
+		}
+		filters = append(filters, func(sr *starredRepositoryEdge) (bool, error) {
+			return re.MatchString(sr.Node.NameWithOwner), nil
+		})
+	}
+	if excludeArchived, _ := flags["--exclude-archived"].(bool); excludeArchived {
+		filters = append(filters, func(sr *starredRepositoryEdge) (bool, error) {
+			return !sr.Node.IsArchived, nil
+		})
+	}
+	if excludeForks, _ := flags["--exclude-forks"].(bool); excludeForks {
+		filters = append(filters, func(sr *starredRepositoryEdge) (bool, error) {
+			return !sr.Node.IsFork, nil
+		})
+	}
+	if where, exists := flags["--where"].(string); exists {
+		filter, err := parseWhere(where)
+		if err != nil {
+			return nil, fmt.Errorf("--where: %w", err)
+		}
+		filters = append(filters, filter)
+	}
+
+	if len(filters) == 0 {
+		return nil, nil
+	}
+	return func(sr *starredRepositoryEdge) (bool, error) {
+		for _, filter := range filters {
+			keep, err := filter(sr)
+			if err != nil || !keep {
+				return false, err
+			}
+		}
+		return true, nil
+	}, nil
+}
+
+// -- --where expressions
+//
+// expr    = or
+// or      = and { "||" and }
+// and     = not { "&&" not }
+// not     = "!" not | compare
+// compare = operand [ ("==" | "!=" | "<" | "<=" | ">" | ">=" | "=~" | "in") operand ]
+// operand = field | number | string | "true" | "false" | "(" expr ")"
+//
+// Expressions are type checked when parsed, so a typo fails before any
+// stars are read
+
+type whereType int
+
+const (
+	whereBool whereType = iota
+	whereInt
+	whereString
+	whereStrings
+	whereTime
+)
+
+func (t whereType) String() string {
+	return [...]string{"bool", "number", "string", "list", "date"}[t]
+}
+
+// whereExpr is a parsed --where expression. Only one of the eval funcs,
+// matching typ, is set
+type whereExpr struct {
+	typ         whereType
+	evalBool    func(sr *starredRepositoryEdge) (bool, error)
+	evalInt     func(sr *starredRepositoryEdge) (int, error)
+	evalString  func(sr *starredRepositoryEdge) (string, error)
+	evalStrings func(sr *starredRepositoryEdge) ([]string, error)
+	evalTime    func(sr *starredRepositoryEdge) (time.Time, error)
+	// literal is set for string literals, so they can be compared as dates
+	literal *string
+}
+
+func boolField(fn func(sr *starredRepositoryEdge) bool) *whereExpr {
+	return &whereExpr{typ: whereBool, evalBool: func(sr *starredRepositoryEdge) (bool, error) { return fn(sr), nil }}
+}
+
+func intField(fn func(sr *starredRepositoryEdge) int) *whereExpr {
+	return &whereExpr{typ: whereInt, evalInt: func(sr *starredRepositoryEdge) (int, error) { return fn(sr), nil }}
+}
+
+func stringField(fn func(sr *starredRepositoryEdge) string) *whereExpr {
+	return &whereExpr{typ: whereString, evalString: func(sr *starredRepositoryEdge) (string, error) { return fn(sr), nil }}
+}
+
+func stringsField(fn func(sr *starredRepositoryEdge) []string) *whereExpr {
+	return &whereExpr{typ: whereStrings, evalStrings: func(sr *starredRepositoryEdge) ([]string, error) { return fn(sr), nil }}
+}
+
+func timeField(name string, fn func(sr *starredRepositoryEdge) formattedDate) *whereExpr {
+	return &whereExpr{typ: whereTime, evalTime: func(sr *starredRepositoryEdge) (time.Time, error) {
+		t, err := fn(sr).Time()
+		if err != nil {
+			return time.Time{}, fmt.Errorf("%s time err: %w", name, err)
+		}
+		return t, nil
+	}}
+}
+
+// whereFields are the fields --where can use
+var whereFields = map[string]*whereExpr{
+	"archived":    boolField(func(sr *starredRepositoryEdge) bool { return sr.Node.IsArchived }),
+	"description": stringField(func(sr *starredRepositoryEdge) string { return sr.Node.Description }),
+	"fork":        boolField(func(sr *starredRepositoryEdge) bool { return sr.Node.IsFork }),
+	"homepage":    stringField(func(sr *starredRepositoryEdge) string { return sr.Node.HomepageURL }),
+	"languages":   stringsField(edgeLanguages),
+	"lists":       stringsField(func(sr *starredRepositoryEdge) []string { return sr.Lists }),
+	"name":        stringField(func(sr *starredRepositoryEdge) string { return sr.Node.NameWithOwner }),
+	"pushed_at":   timeField("PushedAt", func(sr *starredRepositoryEdge) formattedDate { return sr.Node.PushedAt }),
+	"readme":      stringField(func(sr *starredRepositoryEdge) string { return sr.Node.Object.Blob.Text }),
+	"stars":       intField(func(sr *starredRepositoryEdge) int { return sr.Node.StargazerCount }),
+	"starred_at":  timeField("StarredAt", func(sr *starredRepositoryEdge) formattedDate { return sr.StarredAt }),
+	"topics":      stringsField(edgeTopics),
+	"updated_at":  timeField("UpdatedAt", func(sr *starredRepositoryEdge) formattedDate { return sr.Node.UpdatedAt }),
+	"url":         stringField(func(sr *starredRepositoryEdge) string { return sr.Node.Url }),
+}
+
+// whereToken is a token of a --where expression. Strings are unquoted
+type whereToken struct {
+	kind  string // "ident", "number", "string", "op", "eof"
+	value string
+	pos   int
+}
+
+// tokenizeWhere splits a --where expression into tokens. Positions count
+// characters, not bytes, so they line up with non-ASCII input
+func tokenizeWhere(s string) ([]whereToken, error) {
+	var tokens []whereToken
+	rs := []rune(s)
+	isDigit := func(c rune) bool { return c >= '0' && c <= '9' }
+	i := 0
+	for i < len(rs) {
+		c := rs[i]
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case c == '"' || c == '\'':
+			end := i + 1
+			var sb strings.Builder
+			for end < len(rs) && rs[end] != c {
+				if rs[end] == '\\' && end+1 < len(rs) {
+					end++
+				}
+				sb.WriteRune(rs[end])
+				end++
+			}
+			if end >= len(rs) {
+				return nil, fmt.Errorf("unterminated string at %d", i)
+			}
+			tokens = append(tokens, whereToken{kind: "string", value: sb.String(), pos: i})
+			i = end + 1
+		case isDigit(c):
+			end := i
+			for end < len(rs) && isDigit(rs[end]) {
+				end++
+			}
+			tokens = append(tokens, whereToken{kind: "number", value: string(rs[i:end]), pos: i})
+			i = end
+		case unicode.IsLetter(c) || c == '_':
+			end := i
+			for end < len(rs) && (unicode.IsLetter(rs[end]) || unicode.IsDigit(rs[end]) || rs[end] == '_') {
+				end++
+			}
+			tokens = append(tokens, whereToken{kind: "ident", value: string(rs[i:end]), pos: i})
+			i = end
+		default:
+			op := ""
+			rest := string(rs[i:])
+			for _, candidate := range []string{"&&", "||", "==", "!=", "<=", ">=", "=~", "<", ">", "!", "(", ")"} {
+				if strings.HasPrefix(rest, candidate) {
+					op = candidate
+					break
+				}
+			}
+			if op == "" {
+				return nil, fmt.Errorf("unexpected %q at %d", c, i)
+			}
+			tokens = append(tokens, whereToken{kind: "op", value: op, pos: i})
+			// operators are ASCII, so bytes are characters
+			i += len(op)
+		}
+	}
+	tokens = append(tokens, whereToken{kind: "eof", pos: len(rs)})
+	return tokens, nil
+}
+
+type whereParser struct {
+	tokens []whereToken
+	pos    int
+}
+
+func (p *whereParser) peek() whereToken {
+	return p.tokens[p.pos]
+}
+
+func (p *whereParser) next() whereToken {
+	t := p.tokens[p.pos]
+	if t.kind != "eof" {
+		p.pos++
+	}
+	return t
+}
+
+// isOp returns whether the next token is an operator (or the in keyword) in ops
+func (p *whereParser) isOp(ops ...string) bool {
+	t := p.peek()
+	if t.kind != "op" && !(t.kind == "ident" && t.value == "in") {
+		return false
+	}
+	for _, op := range ops {
+		if t.value == op {
+			return true
+		}
+	}
+	return false
+}
+
+// parseWhere parses a --where expression into a filter
+func parseWhere(s string) (edgeFilter, error) {
+	tokens, err := tokenizeWhere(s)
+	if err != nil {
+		return nil, err
+	}
+	p := &whereParser{tokens: tokens}
+	expr, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != "eof" {
+		return nil, fmt.Errorf("unexpected %q at %d", t.value, t.pos)
+	}
+	if expr.typ != whereBool {
+		return nil, fmt.Errorf("expression is a %s, not a bool", expr.typ)
+	}
+	return edgeFilter(expr.evalBool), nil
+}
+
+func (p *whereParser) parseOr() (*whereExpr, error) {
+	return p.parseLogical("||", p.parseAnd)
+}
+
+func (p *whereParser) parseAnd() (*whereExpr, error) {
+	return p.parseLogical("&&", p.parseNot)
+}
+
+func (p *whereParser) parseLogical(op string, parseOperand func() (*whereExpr, error)) (*whereExpr, error) {
+	left, err := parseOperand()
+	if err != nil {
+		return nil, err
+	}
+	for p.isOp(op) {
+		t := p.next()
+		right, err := parseOperand()
+		if err != nil {
+			return nil, err
+		}
+		if left.typ != whereBool || right.typ != whereBool {
+			return nil, fmt.Errorf("%s at %d needs bools, not %s and %s", op, t.pos, left.typ, right.typ)
+		}
+		l, r := left.evalBool, right.evalBool
+		isOr := op == "||"
+		left = &whereExpr{typ: whereBool, evalBool: func(sr *starredRepositoryEdge) (bool, error) {
+			lv, err := l(sr)
+			if err != nil {
+				return false, err
+			}
+			// short circuit
+			if lv == isOr {
+				return lv, nil
+			}
+			return r(sr)
+		}}
+	}
+	return left, nil
+}
+
+func (p *whereParser) parseNot() (*whereExpr, error) {
+	if !p.isOp("!") {
+		return p.parseCompare()
+	}
+	t := p.next()
+	operand, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	if operand.typ != whereBool {
+		return nil, fmt.Errorf("! at %d needs a bool, not %s", t.pos, operand.typ)
+	}
+	eval := operand.evalBool
+	return &whereExpr{typ: whereBool, evalBool: func(sr *starredRepositoryEdge) (bool, error) {
+		v, err := eval(sr)
+		return !v, err
+	}}, nil
+}
+
+// asTime lets a string literal stand in for a date
+func asTime(e *whereExpr) (*whereExpr, error) {
+	if e.typ == whereTime {
+		return e, nil
+	}
+	t, err := parseFilterTime(*e.literal)
+	if err != nil {
+		return nil, err
+	}
+	return &whereExpr{typ: whereTime, evalTime: func(sr *starredRepositoryEdge) (time.Time, error) { return t, nil }}, nil
+}
+
+// compareResult turns a three way comparison into the result of op
+func compareResult(op string, cmp int) bool {
+	switch op {
+	case "==":
+		return cmp == 0
+	case "!=":
+		return cmp != 0
+	case "<":
+		return cmp < 0
+	case "<=":
+		return cmp <= 0
+	case ">":
+		return cmp > 0
+	default: // ">="
+		return cmp >= 0
+	}
+}
+
+func (p *whereParser) parseCompare() (*whereExpr, error) {
+	left, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+	if !p.isOp("==", "!=", "<", "<=", ">", ">=", "=~", "in") {
+		return left, nil
+	}
+	t := p.next()
+	op := t.value
+	right, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+	mismatch := func() error {
+		return fmt.Errorf("can't use %s at %d on %s and %s", op, t.pos, left.typ, right.typ)
+	}
+
+	// dates can be compared to string literals
+	if left.typ == whereTime && right.literal != nil {
+		right, err = asTime(right)
+	} else if right.typ == whereTime && left.literal != nil {
+		left, err = asTime(left)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s at %d: %w", op, t.pos, err)
+	}
+
+	switch op {
+	case "=~":
+		if left.typ != whereString || right.literal == nil {
+			return nil, fmt.Errorf("=~ at %d needs a string and a regex string literal", t.pos)
+		}
+		re, err := regexp.Compile(*right.literal)
+		if err != nil {
+			return nil, fmt.Errorf("=~ at %d: %w", t.pos, err)
+		}
+		l := left.evalString
+		return &whereExpr{typ: whereBool, evalBool: func(sr *starredRepositoryEdge) (bool, error) {
+			s, err := l(sr)
+			return err == nil && re.MatchString(s), err
+		}}, nil
+
+	case "in":
+		if left.typ != whereString {
+			return nil, mismatch()
+		}
+		l := left.evalString
+		switch right.typ {
+		case whereStrings:
+			r := right.evalStrings
+			return &whereExpr{typ: whereBool, evalBool: func(sr *starredRepositoryEdge) (bool, error) {
+				s, err := l(sr)
+				if err != nil {
+					return false, err
+				}
+				list, err := r(sr)
+				return err == nil && containsFold(list, s), err
+			}}, nil
+		case whereString:
+			r := right.evalString
+			return &whereExpr{typ: whereBool, evalBool: func(sr *starredRepositoryEdge) (bool, error) {
+				s, err := l(sr)
+				if err != nil {
+					return false, err
+				}
+				str, err := r(sr)
+				return err == nil && strings.Contains(strings.ToLower(str), strings.ToLower(s)), err
+			}}, nil
+		default:
+			return nil, mismatch()
+		}
+	}
+
+	if left.typ != right.typ {
+		return nil, mismatch()
+	}
+	var cmp func(sr *starredRepositoryEdge) (int, error)
+	switch left.typ {
+	case whereInt:
+		l, r := left.evalInt, right.evalInt
+		cmp = func(sr *starredRepositoryEdge) (int, error) {
+			lv, err := l(sr)
+			if err != nil {
+				return 0, err
+			}
+			rv, err := r(sr)
+			if err != nil {
+				return 0, err
+			}
+			switch {
+			case lv < rv:
+				return -1, nil
+			case lv > rv:
+				return 1, nil
+			}
+			return 0, nil
+		}
+	case whereTime:
+		l, r := left.evalTime, right.evalTime
+		cmp = func(sr *starredRepositoryEdge) (int, error) {
+			lv, err := l(sr)
+			if err != nil {
+				return 0, err
+			}
+			rv, err := r(sr)
+			if err != nil {
+				return 0, err
+			}
+			switch {
+			case lv.Before(rv):
+				return -1, nil
+			case lv.After(rv):
+				return 1, nil
+			}
+			return 0, nil
+		}
+	case whereString:
+		l, r := left.evalString, right.evalString
+		cmp = func(sr *starredRepositoryEdge) (int, error) {
+			lv, err := l(sr)
+			if err != nil {
+				return 0, err
+			}
+			rv, err := r(sr)
+			if err != nil {
+				return 0, err
+			}
+			return strings.Compare(lv, rv), nil
+		}
+	case whereBool:
+		if op != "==" && op != "!=" {
+			return nil, mismatch()
+		}
+		l, r := left.evalBool, right.evalBool
+		cmp = func(sr *starredRepositoryEdge) (int, error) {
+			lv, err := l(sr)
+			if err != nil {
+				return 0, err
+			}
+			rv, err := r(sr)
+			if err != nil || lv == rv {
+				return 0, err
+			}
+			return 1, nil
+		}
+	default:
+		return nil, mismatch()
+	}
+	return &whereExpr{typ: whereBool, evalBool: func(sr *starredRepositoryEdge) (bool, error) {
+		c, err := cmp(sr)
+		return err == nil && compareResult(op, c), err
+	}}, nil
+}
+
+func (p *whereParser) parseOperand() (*whereExpr, error) {
+	t := p.next()
+	switch t.kind {
+	case "number":
+		n, err := strconv.Atoi(t.value)
+		if err != nil {
+			return nil, fmt.Errorf("bad number at %d: %w", t.pos, err)
+		}
+		return intField(func(sr *starredRepositoryEdge) int { return n }), nil
+	case "string":
+		s := t.value
+		e := stringField(func(sr *starredRepositoryEdge) string { return s })
+		e.literal = &s
+		return e, nil
+	case "ident":
+		switch t.value {
+		case "true", "false":
+			b := t.value == "true"
+			return boolField(func(sr *starredRepositoryEdge) bool { return b }), nil
+		}
+		field, exists := whereFields[t.value]
+		if !exists {
+			known := make([]string, 0, len(whereFields))
+			for name := range whereFields {
+				known = append(known, name)
+			}
+			sort.Strings(known)
+			return nil, fmt.Errorf("unknown field %q at %d. Known fields: %s", t.value, t.pos, strings.Join(known, ", "))
+		}
+		return field, nil
+	case "op":
+		if t.value == "(" {
+			e, err := p.parseOr()
+			if err != nil {
+				return nil, err
+			}
+			if closing := p.next(); closing.kind != "op" || closing.value != ")" {
+				return nil, fmt.Errorf("expected ) at %d", closing.pos)
+			}
+			return e, nil
+		}
+	}
+	if t.kind == "eof" {
+		return nil, fmt.Errorf("unexpected end of expression")
+	}
+	return nil, fmt.Errorf("unexpected %q at %d", t.value, t.pos)
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseWhere(t *testing.T) {
+	var edge starredRepositoryEdge
+	edge.StarredAt = formattedDate{datetime: "2021-06-01T00:00:00Z"}
+	edge.Node.NameWithOwner = "a/db"
+	edge.Node.Description = "A fast café DB"
+	edge.Node.StargazerCount = 150
+	edge.Node.Languages.Edges = make([]struct {
+		Size int
+		Node struct {
+			Name string
+		}
+	}, 1)
+	edge.Node.Languages.Edges[0].Node.Name = "Go"
+
+	tests := []struct {
+		where   string
+		want    bool
+		wantErr string
+	}{
+		// && binds tighter than ||
+		{where: `stars > 100 || archived && fork`, want: true},
+		{where: `(stars > 100 || archived) && fork`, want: false},
+		{where: `!archived && stars < 100 || name == "a/db"`, want: true},
+		{where: `!(stars >= 150)`, want: false},
+
+		{where: `"go" in languages`, want: true},
+		{where: `"rust" in languages`, want: false},
+		{where: `"FAST" in description`, want: true},
+		{where: `stars in languages`, wantErr: "can't use in at 6 on number and list"},
+
+		{where: `name =~ "^a/"`, want: true},
+		{where: `description =~ "^B"`, want: false},
+		{where: `name =~ "("`, wantErr: "=~ at 5"},
+		{where: `name =~ name`, wantErr: "=~ at 5 needs a string and a regex string literal"},
+
+		{where: `starred_at > "2021-01-01"`, want: true},
+		{where: `starred_at < "2021-06-01T00:00:00Z"`, want: false},
+		{where: `"2022-01-01" > starred_at`, want: true},
+		{where: `starred_at > "yesterday"`, wantErr: "> at 11"},
+
+		{where: `"café" in description`, want: true},
+		{where: `description == 'it\'s'`, want: false},
+		{where: `café == "x"`, wantErr: `unknown field "café" at 0`},
+		{where: `"é" == name && stars ? 1`, wantErr: `unexpected '?' at 21`},
+
+		{where: `stars >`, wantErr: "unexpected end of expression"},
+		{where: `(stars > 1 ")"`, wantErr: "expected ) at 11"},
+		{where: `(stars > 1`, wantErr: "expected ) at 10"},
+		{where: `stars > 1)`, wantErr: `unexpected ")" at 9`},
+		{where: `stars > "a"`, wantErr: "can't use > at 6 on number and string"},
+		{where: `name == "x`, wantErr: "unterminated string at 8"},
+		{where: `stars`, wantErr: "expression is a number, not a bool"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.where, func(t *testing.T) {
+			filter, err := parseWhere(tt.where)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("want error containing %q, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := filter(&edge)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Fatalf("want %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
@@ -7,14 +7,15 @@ import (
 	"embed"
 	"encoding/csv"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"os"
 	"strconv"
 	"strings"
 	"time"
+	"unicode/utf8"
 
-	"github.com/lestrrat-go/strftime"
 	"go.bbkane.com/warg/command"
 	_ "modernc.org/sqlite"
 )
@@ -65,83 +66,228 @@ func (JSONPrinter) Flush() error {
 	return nil
 }
 
+// -- CSV columns
+
+// cellKind tells typed outputs (like Google Sheets) how to store a column
+type cellKind int
+
+const (
+	cellString cellKind = iota
+	cellNumber
+	cellDate
+	cellURL
+)
+
+// csvColumn is a column of CSV-like output. Value returns an int for
+// cellNumber, a formattedDate for cellDate, and a string otherwise. count is
+// the 1-based row number.
+type csvColumn struct {
+	Name  string
+	Kind  cellKind
+	Value func(sr *starredRepositoryEdge, count int) interface{}
+}
+
+// csvList is a list cell. CSV output joins it with --list-separator, and
+// other outputs with a space
+type csvList []string
+
+func joinTopics(sr *starredRepositoryEdge) string {
+	topicsList := []string{}
+	for i := range sr.Node.RepositoryTopics.Nodes {
+		topicsList = append(topicsList, sr.Node.RepositoryTopics.Nodes[i].Topic.Name)
+	}
+	return strings.Join(topicsList, " ")
+}
+
+func joinLanguages(sr *starredRepositoryEdge) string {
+	languagesList := []string{}
+	for i := range sr.Node.Languages.Edges {
+		languagesList = append(languagesList, sr.Node.Languages.Edges[i].Node.Name)
+	}
+	return strings.Join(languagesList, " ")
+}
+
+var csvColumns = []csvColumn{
+	{"Count", cellNumber, func(sr *starredRepositoryEdge, count int) interface{} { return count }},
+	{"Description", cellString, func(sr *starredRepositoryEdge, count int) interface{} { return sr.Node.Description }},
+	{"HomepageURL", cellURL, func(sr *starredRepositoryEdge, count int) interface{} { return sr.Node.HomepageURL }},
+	{"NameWithOwner", cellString, func(sr *starredRepositoryEdge, count int) interface{} { return sr.Node.NameWithOwner }},
+	{"Languages", cellString, func(sr *starredRepositoryEdge, count int) interface{} { return csvList(edgeLanguages(sr)) }},
+	{"PushedAt", cellDate, func(sr *starredRepositoryEdge, count int) interface{} { return sr.Node.PushedAt }},
+	{"README", cellString, func(sr *starredRepositoryEdge, count int) interface{} { return sr.Node.Object.Blob.Text }},
+	{"StargazerCount", cellNumber, func(sr *starredRepositoryEdge, count int) interface{} { return sr.Node.StargazerCount }},
+	{"StarredAt", cellDate, func(sr *starredRepositoryEdge, count int) interface{} { return sr.StarredAt }},
+	{"Topics", cellString, func(sr *starredRepositoryEdge, count int) interface{} { return csvList(edgeTopics(sr)) }},
+	{"UpdatedAt", cellDate, func(sr *starredRepositoryEdge, count int) interface{} { return sr.Node.UpdatedAt }},
+	{"Url", cellURL, func(sr *starredRepositoryEdge, count int) interface{} { return sr.Node.Url }},
+}
+
+// csvExtraColumns can be chosen with --columns but aren't printed by default
+var csvExtraColumns = []csvColumn{
+	{"IsArchived", cellString, func(sr *starredRepositoryEdge, count int) interface{} { return sr.Node.IsArchived }},
+	{"IsFork", cellString, func(sr *starredRepositoryEdge, count int) interface{} { return sr.Node.IsFork }},
+	{"LanguageCount", cellNumber, func(sr *starredRepositoryEdge, count int) interface{} { return len(sr.Node.Languages.Edges) }},
+	{"Lists", cellString, func(sr *starredRepositoryEdge, count int) interface{} { return csvList(sr.Lists) }},
+	{"TopLanguage", cellString, func(sr *starredRepositoryEdge, count int) interface{} { return topLanguage(sr) }},
+	{"TopicCount", cellNumber, func(sr *starredRepositoryEdge, count int) interface{} { return len(sr.Node.RepositoryTopics.Nodes) }},
+}
+
+// topLanguage returns the language with the most code in a repo
+func topLanguage(sr *starredRepositoryEdge) string {
+	top := ""
+	topSize := -1
+	for _, edge := range sr.Node.Languages.Edges {
+		if edge.Size > topSize {
+			top = edge.Node.Name
+			topSize = edge.Size
+		}
+	}
+	return top
+}
+
+// lookupCSVColumns finds columns by name (ignoring case) in csvColumns and
+// csvExtraColumns
+func lookupCSVColumns(names []string) ([]csvColumn, error) {
+	var columns []csvColumn
+	for _, name := range names {
+		found := false
+		for _, table := range [][]csvColumn{csvColumns, csvExtraColumns} {
+			for i := range table {
+				if strings.EqualFold(table[i].Name, name) {
+					columns = append(columns, table[i])
+					found = true
+				}
+			}
+		}
+		if !found {
+			known := []string{}
+			for _, table := range [][]csvColumn{csvColumns, csvExtraColumns} {
+				for i := range table {
+					known = append(known, table[i].Name)
+				}
+			}
+			return nil, fmt.Errorf("unknown column: %s. Known columns: %s", name, strings.Join(known, ", "))
+		}
+	}
+	return columns, nil
+}
+
+// csvColumnNames joins the names of columns for help text
+func csvColumnNames(columns []csvColumn) string {
+	names := []string{}
+	for i := range columns {
+		names = append(names, columns[i].Name)
+	}
+	return strings.Join(names, ", ")
+}
+
+// csvColumnIndex returns the index of the named column in csvColumns
+func csvColumnIndex(name string) int {
+	for i := range csvColumns {
+		if csvColumns[i].Name == name {
+			return i
+		}
+	}
+	panic("unknown CSV column: " + name)
+}
+
+// csvCellString formats a csvColumn Value as text
+func csvCellString(v interface{}) (string, error) {
+	switch v := v.(type) {
+	case int:
+		return strconv.Itoa(v), nil
+	case formattedDate:
+		return v.FormatString()
+	case string:
+		return v, nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	case csvList:
+		return strings.Join(v, " "), nil
+	default:
+		return "", fmt.Errorf("unknown cell type: %T", v)
+	}
+}
+
 // -- CSVPrinter
 
+// csvOptions customize CSVPrinter. The zero value prints csvColumns,
+// comma separated, with lists joined by spaces
+type csvOptions struct {
+	// Columns to print, in order. Defaults to csvColumns
+	Columns []csvColumn
+	// Delimiter between fields. Defaults to a comma
+	Delimiter rune
+	// ListSeparator joins list cells like Languages and Topics. Defaults to a space
+	ListSeparator string
+	// ReadmeMaxChars truncates READMEs if more than 0
+	ReadmeMaxChars int
+}
+
 type CSVPrinter struct {
 	writer *csv.Writer
 	count  int
+	opts   csvOptions
 }
 
-func NewCSVPrinter(w io.Writer) *CSVPrinter {
+func NewCSVPrinter(w io.Writer, opts csvOptions) *CSVPrinter {
+	if opts.Columns == nil {
+		opts.Columns = csvColumns
+	}
+	if opts.ListSeparator == "" {
+		opts.ListSeparator = " "
+	}
+	writer := csv.NewWriter(w)
+	if opts.Delimiter != 0 {
+		writer.Comma = opts.Delimiter
+	}
 	return &CSVPrinter{
-		writer: csv.NewWriter(w),
+		writer: writer,
 		count:  1,
+		opts:   opts,
 	}
 }
 
 func (p *CSVPrinter) Header() error {
-	err := p.writer.Write([]string{
-		"Count",
-		"Description",
-		"HomepageURL",
-		"NameWithOwner",
-		"Languages",
-		"PushedAt",
-		"README",
-		"StargazerCount",
-		"StarredAt",
-		"Topics",
-		"UpdatedAt",
-		"Url",
-	})
+	header := make([]string, len(p.opts.Columns))
+	for i := range p.opts.Columns {
+		header[i] = p.opts.Columns[i].Name
+	}
+	err := p.writer.Write(header)
 	if err != nil {
 		return fmt.Errorf("CSV header err: %w", err)
 	}
 	return nil
 }
 
-func (p *CSVPrinter) Line(sr *starredRepositoryEdge) error {
-
-	topicsList := []string{}
-	for i := range sr.Node.RepositoryTopics.Nodes {
-		topicsList = append(topicsList, sr.Node.RepositoryTopics.Nodes[i].Topic.Name)
-	}
-	topics := strings.Join(topicsList, " ")
-
-	pushedAt, err := sr.Node.PushedAt.FormatString()
-	if err != nil {
-		return err
-	}
-	starredAt, err := sr.StarredAt.FormatString()
-	if err != nil {
-		return nil
-	}
-
-	updatedAt, err := sr.Node.UpdatedAt.FormatString()
-	if err != nil {
-		return nil
+// truncateChars shortens s to at most n characters
+func truncateChars(s string, n int) string {
+	if utf8.RuneCountInString(s) <= n {
+		return s
 	}
+	return string([]rune(s)[:n])
+}
 
-	languagesList := []string{}
-	for i := range sr.Node.Languages.Edges {
-		languagesList = append(languagesList, sr.Node.Languages.Edges[i].Node.Name)
+func (p *CSVPrinter) Line(sr *starredRepositoryEdge) error {
+	record := make([]string, len(p.opts.Columns))
+	for i := range p.opts.Columns {
+		v := p.opts.Columns[i].Value(sr, p.count)
+		var cell string
+		var err error
+		if list, ok := v.(csvList); ok {
+			cell = strings.Join(list, p.opts.ListSeparator)
+		} else {
+			cell, err = csvCellString(v)
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %s: %w", sr.Node.NameWithOwner, p.opts.Columns[i].Name, err)
+		}
+		if p.opts.ReadmeMaxChars > 0 && p.opts.Columns[i].Name == "README" {
+			cell = truncateChars(cell, p.opts.ReadmeMaxChars)
+		}
+		record[i] = cell
 	}
-	languages := strings.Join(languagesList, " ")
-
-	err = p.writer.Write([]string{
-		strconv.Itoa(p.count),
-		sr.Node.Description,
-		sr.Node.HomepageURL,
-		sr.Node.NameWithOwner,
-		languages,
-		pushedAt,
-		sr.Node.Object.Blob.Text, // README
-		strconv.Itoa(sr.Node.StargazerCount),
-		starredAt,
-		topics,
-		updatedAt,
-		sr.Node.Url,
-	})
+	err := p.writer.Write(record)
 	p.count++
 	if err != nil {
 		return fmt.Errorf("CSV write err: %w", err)
@@ -154,6 +300,41 @@ func (p *CSVPrinter) Flush() error {
 	return p.writer.Error()
 }
 
+// csvOptionsFromFlags reads the CSV flags passed to format
+func csvOptionsFromFlags(flags map[string]interface{}) (csvOptions, error) {
+	var opts csvOptions
+	if columns, exists := flags["--columns"].([]string); exists {
+		var names []string
+		for _, column := range columns {
+			for _, name := range strings.Split(column, ",") {
+				name = strings.TrimSpace(name)
+				if name != "" {
+					names = append(names, name)
+				}
+			}
+		}
+		var err error
+		opts.Columns, err = lookupCSVColumns(names)
+		if err != nil {
+			return opts, fmt.Errorf("--columns: %w", err)
+		}
+	}
+	if delimiter, exists := flags["--delimiter"].(string); exists {
+		switch delimiter {
+		case "tab", `\t`:
+			delimiter = "\t"
+		}
+		r, size := utf8.DecodeRuneInString(delimiter)
+		if size != len(delimiter) || r == utf8.RuneError || r == '"' || r == '\r' || r == '\n' {
+			return opts, fmt.Errorf("--delimiter must be a single character other than a quote or newline, or tab: %q", delimiter)
+		}
+		opts.Delimiter = r
+	}
+	opts.ListSeparator, _ = flags["--list-separator"].(string)
+	opts.ReadmeMaxChars, _ = flags["--readme-max-chars"].(int)
+	return opts, nil
+}
+
 // -- SqlitePrinter
 
 type SqlitePrinter struct {
@@ -167,25 +348,24 @@ type SqlitePrinter struct {
 	tx *sql.Tx
 }
 
-func NewSqlitePrinter(dsn string) (*SqlitePrinter, error) {
-	db, err := sql.Open("sqlite", dsn)
+// NewSqlitePrinter opens (and migrates) the database at dsn. If ftsTokenizer
+// is not empty, Repo_fts is rebuilt to use it if needed.
+func NewSqlitePrinter(dsn string, ftsTokenizer string) (*SqlitePrinter, error) {
+	db, err := openSqliteDB(dsn)
 	if err != nil {
-		return nil, fmt.Errorf("db open error: %s: %w", dsn, err)
+		return nil, err
 	}
 
-	// Enable foreign key checks. For historical reasons, SQLite does not check
-	// foreign key constraints by default... which is kinda insane. There's some
-	// overhead on inserts to verify foreign key integrity but it's definitely
-	// worth it.
-	if _, err := db.Exec(`PRAGMA foreign_keys = ON;`); err != nil {
-		return nil, fmt.Errorf("foreign keys pragma: %w", err)
-	}
-	if err := migrate(db, migrationFS); err != nil {
-		return nil, fmt.Errorf("migrate: %w", err)
+	if ftsTokenizer != "" {
+		if err := ensureFTSTokenizer(db, ftsTokenizer); err != nil {
+			_ = db.Close()
+			return nil, fmt.Errorf("fts tokenizer: %w", err)
+		}
 	}
 
 	tx, err := db.Begin()
 	if err != nil {
+		_ = db.Close()
 		err = fmt.Errorf("can't begin tx: %w", err)
 		return nil, err
 	}
@@ -244,44 +424,26 @@ func (p *SqlitePrinter) Line(sr *starredRepositoryEdge) error {
 			p.err = err
 			return err
 		}
-		stmt, err := p.Prep(
-			`
-			INSERT INTO Repo (
-				StarredAt,
-				Description,
-				HomepageURL,
-				NameWithOwner,
-				Readme,
-				PushedAt,
-				StargazerCount,
-				UpdatedAt,
-				Url
-			)
-			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
-			RETURNING id
-			`,
-		)
+		repoID, err = p.upsertRepo(sr, starredAt, pushedAt, updatedAt)
 		if err != nil {
-			err = fmt.Errorf("RepoInsert prep err: %w", err)
 			p.err = err
 			return err
 		}
-		err = stmt.QueryRowContext(
-			p.ctx,
-			(*NullTime)(&starredAt),
-			sr.Node.Description,
-			sr.Node.HomepageURL,
-			sr.Node.NameWithOwner,
-			sr.Node.Object.Blob.Text,
-			(*NullTime)(&pushedAt),
-			sr.Node.StargazerCount,
-			(*NullTime)(&updatedAt),
-			sr.Node.Url,
-		).Scan(&repoID)
-		if err != nil {
-			err = fmt.Errorf("repo insert scan err: %w", err)
-			p.err = err
-			return err
+
+		// Languages and topics are replaced, not merged
+		for _, table := range []string{"Language_Repo", "Repo_Topic"} {
+			stmt, err := p.Prep(`DELETE FROM ` + table + ` WHERE Repo_id = ?`)
+			if err != nil {
+				err = fmt.Errorf("%s delete prep err: %w", table, err)
+				p.err = err
+				return err
+			}
+			_, err = stmt.ExecContext(p.ctx, repoID)
+			if err != nil {
+				err = fmt.Errorf("%s delete err: %w", table, err)
+				p.err = err
+				return err
+			}
 		}
 	}
 
@@ -460,9 +622,273 @@ func (p *SqlitePrinter) Line(sr *starredRepositoryEdge) error {
 		}
 	}
 
+	// List. Downloads without lists don't change them
+	if sr.Lists != nil {
+		stmt, err := p.Prep(`DELETE FROM List_Repo WHERE Repo_id = ?`)
+		if err != nil {
+			err = fmt.Errorf("list_repo delete prep err: %w", err)
+			p.err = err
+			return err
+		}
+		_, err = stmt.ExecContext(p.ctx, repoID)
+		if err != nil {
+			err = fmt.Errorf("list_repo delete err: %w", err)
+			p.err = err
+			return err
+		}
+
+		for _, listName := range sr.Lists {
+			stmt, err := p.Prep(
+				`
+				INSERT INTO List (
+					Name
+				)
+				VALUES (?)
+				ON CONFLICT(Name)
+				DO UPDATE SET Name = excluded.Name
+				RETURNING id
+				`,
+			)
+			if err != nil {
+				err = fmt.Errorf("list insert prep err: %w", err)
+				p.err = err
+				return err
+			}
+			var listID int
+			err = stmt.QueryRowContext(
+				p.ctx,
+				listName,
+			).Scan(&listID)
+			if err != nil {
+				err = fmt.Errorf("list insert scan err: %w", err)
+				p.err = err
+				return err
+			}
+
+			stmt, err = p.Prep(
+				`
+				INSERT INTO List_Repo (
+					List_id,
+					Repo_id
+				)
+				VALUES (?, ?)
+				ON CONFLICT(List_id, Repo_id)
+				DO NOTHING
+				`,
+			)
+			if err != nil {
+				err = fmt.Errorf("list_repo insert prep err: %w", err)
+				p.err = err
+				return err
+			}
+			_, err = stmt.ExecContext(
+				p.ctx,
+				listID,
+				repoID,
+			)
+			if err != nil {
+				err = fmt.Errorf("list_repo insert err: %s: %w", sr.Node.NameWithOwner, err)
+				p.err = err
+				return err
+			}
+		}
+	}
+
 	return nil
 }
 
+// nullString stores empty strings as NULL
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
+
+// staleRepoSuffix marks the name of a Repo row whose name was taken by
+// another repo. GitHub names can't have spaces, so marked names can't clash
+// with real ones
+func staleRepoSuffix(repoID int) string {
+	return fmt.Sprintf(" (renamed, id %d)", repoID)
+}
+
+// upsertRepo inserts or updates a repo, returning its id. Repos are matched on
+// NodeID, falling back to NameWithOwner for downloads and rows from before
+// node IDs. If a repo's name changed, the old name is saved in RepoAlias
+func (p *SqlitePrinter) upsertRepo(sr *starredRepositoryEdge, starredAt time.Time, pushedAt time.Time, updatedAt time.Time) (int, error) {
+	repoID := 0
+	var oldName string
+	var oldNodeID sql.NullString
+	if sr.Node.ID != "" {
+		stmt, err := p.Prep(`SELECT id, NameWithOwner, NodeID FROM Repo WHERE NodeID = ?`)
+		if err != nil {
+			return 0, fmt.Errorf("repo select prep err: %w", err)
+		}
+		err = stmt.QueryRowContext(p.ctx, sr.Node.ID).Scan(&repoID, &oldName, &oldNodeID)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return 0, fmt.Errorf("repo select err: %w", err)
+		}
+	}
+	if repoID == 0 {
+		stmt, err := p.Prep(`SELECT id, NameWithOwner, NodeID FROM Repo WHERE NameWithOwner = ?`)
+		if err != nil {
+			return 0, fmt.Errorf("repo select prep err: %w", err)
+		}
+		err = stmt.QueryRowContext(p.ctx, sr.Node.NameWithOwner).Scan(&repoID, &oldName, &oldNodeID)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return 0, fmt.Errorf("repo select err: %w", err)
+		}
+		if repoID != 0 && oldNodeID.Valid && sr.Node.ID != "" && oldNodeID.String != sr.Node.ID {
+			return 0, fmt.Errorf("%s is a different repo (node ID %s) than the one with that name in the db (node ID %s). Format a download with both repos to update the other's name", sr.Node.NameWithOwner, sr.Node.ID, oldNodeID.String)
+		}
+	}
+
+	if repoID == 0 {
+		stmt, err := p.Prep(
+			`
+			INSERT INTO Repo (
+				StarredAt,
+				Description,
+				HomepageURL,
+				NameWithOwner,
+				Readme,
+				PushedAt,
+				StargazerCount,
+				UpdatedAt,
+				Url,
+				NodeID,
+				DatabaseID
+			)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+			RETURNING id
+			`,
+		)
+		if err != nil {
+			return 0, fmt.Errorf("RepoInsert prep err: %w", err)
+		}
+		err = stmt.QueryRowContext(
+			p.ctx,
+			(*NullTime)(&starredAt),
+			sr.Node.Description,
+			sr.Node.HomepageURL,
+			sr.Node.NameWithOwner,
+			sr.Node.Object.Blob.Text,
+			(*NullTime)(&pushedAt),
+			sr.Node.StargazerCount,
+			(*NullTime)(&updatedAt),
+			sr.Node.Url,
+			nullString(sr.Node.ID),
+			sql.NullInt64{Int64: int64(sr.Node.DatabaseID), Valid: sr.Node.DatabaseID != 0},
+		).Scan(&repoID)
+		if err != nil {
+			return 0, fmt.Errorf("repo insert scan err: %w", err)
+		}
+		return repoID, nil
+	}
+
+	if oldName != sr.Node.NameWithOwner {
+		// the repo might have moved back to an old name
+		stmt, err := p.Prep(`DELETE FROM RepoAlias WHERE NameWithOwner = ?`)
+		if err != nil {
+			return 0, fmt.Errorf("RepoAlias delete prep err: %w", err)
+		}
+		_, err = stmt.ExecContext(p.ctx, sr.Node.NameWithOwner)
+		if err != nil {
+			return 0, fmt.Errorf("RepoAlias delete err: %w", err)
+		}
+
+		aliasStmt, err := p.Prep(
+			`
+			INSERT INTO RepoAlias (
+				Repo_id,
+				NameWithOwner,
+				RenamedAt
+			)
+			VALUES (?, ?, ?)
+			ON CONFLICT(NameWithOwner)
+			DO UPDATE SET Repo_id = excluded.Repo_id, RenamedAt = excluded.RenamedAt
+			`,
+		)
+		if err != nil {
+			return 0, fmt.Errorf("RepoAlias insert prep err: %w", err)
+		}
+		now := time.Now()
+
+		// Another row can hold the new name if the db has a stale name for
+		// it, like when two repos swap names, or a new repo takes a renamed
+		// repo's old name. Save the name as that row's alias and mark the
+		// row renamed until it's formatted again
+		stmt, err = p.Prep(`SELECT id FROM Repo WHERE NameWithOwner = ? AND id != ?`)
+		if err != nil {
+			return 0, fmt.Errorf("repo select prep err: %w", err)
+		}
+		otherID := 0
+		err = stmt.QueryRowContext(p.ctx, sr.Node.NameWithOwner, repoID).Scan(&otherID)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return 0, fmt.Errorf("repo select err: %w", err)
+		}
+		if otherID != 0 {
+			stmt, err = p.Prep(`UPDATE Repo SET NameWithOwner = ? WHERE id = ?`)
+			if err != nil {
+				return 0, fmt.Errorf("repo rename prep err: %w", err)
+			}
+			_, err = stmt.ExecContext(p.ctx, sr.Node.NameWithOwner+staleRepoSuffix(otherID), otherID)
+			if err != nil {
+				return 0, fmt.Errorf("repo rename err: %s: %w", sr.Node.NameWithOwner, err)
+			}
+			_, err = aliasStmt.ExecContext(p.ctx, otherID, sr.Node.NameWithOwner, (*NullTime)(&now))
+			if err != nil {
+				return 0, fmt.Errorf("RepoAlias insert err: %s: %w", sr.Node.NameWithOwner, err)
+			}
+		}
+
+		// a stale name's real name is already an alias
+		if !strings.HasSuffix(oldName, staleRepoSuffix(repoID)) {
+			_, err = aliasStmt.ExecContext(p.ctx, repoID, oldName, (*NullTime)(&now))
+			if err != nil {
+				return 0, fmt.Errorf("RepoAlias insert err: %s: %w", oldName, err)
+			}
+		}
+	}
+
+	stmt, err := p.Prep(
+		`
+		UPDATE Repo SET
+			StarredAt = ?,
+			Description = ?,
+			HomepageURL = ?,
+			NameWithOwner = ?,
+			Readme = ?,
+			PushedAt = ?,
+			StargazerCount = ?,
+			UpdatedAt = ?,
+			Url = ?,
+			NodeID = COALESCE(?, NodeID),
+			DatabaseID = COALESCE(?, DatabaseID)
+		WHERE id = ?
+		`,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("RepoUpdate prep err: %w", err)
+	}
+	_, err = stmt.ExecContext(
+		p.ctx,
+		(*NullTime)(&starredAt),
+		sr.Node.Description,
+		sr.Node.HomepageURL,
+		sr.Node.NameWithOwner,
+		sr.Node.Object.Blob.Text,
+		(*NullTime)(&pushedAt),
+		sr.Node.StargazerCount,
+		(*NullTime)(&updatedAt),
+		sr.Node.Url,
+		nullString(sr.Node.ID),
+		sql.NullInt64{Int64: int64(sr.Node.DatabaseID), Valid: sr.Node.DatabaseID != 0},
+		repoID,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("repo update err: %s: %w", sr.Node.NameWithOwner, err)
+	}
+	return repoID, nil
+}
+
 func (p *SqlitePrinter) Flush() error {
 
 	if p.err != nil {
@@ -507,11 +933,7 @@ func (p *ZincPrinter) Line(sr *starredRepositoryEdge) error {
 		return fmt.Errorf("header write err: %w", err)
 	}
 
-	topics := []string{}
-	for i := range sr.Node.RepositoryTopics.Nodes {
-		topics = append(topics, sr.Node.RepositoryTopics.Nodes[i].Topic.Name)
-	}
-	topicsStr := strings.Join(topics, " ")
+	topicsStr := joinTopics(sr)
 	pushedAt, err := sr.Node.PushedAt.FormatString()
 	if err != nil {
 		return err
@@ -526,12 +948,7 @@ func (p *ZincPrinter) Line(sr *starredRepositoryEdge) error {
 		return nil
 	}
 
-	languagesList := []string{}
-	for i := range sr.Node.Languages.Edges {
-		languagesList = append(languagesList, sr.Node.Languages.Edges[i].Node.Name)
-	}
-	languages := strings.Join(languagesList, " ")
-
+	languages := joinLanguages(sr)
 	item := map[string]interface{}{
 		"Description":    sr.Node.Description,
 		"HomepageURL":    sr.Node.HomepageURL,
@@ -545,6 +962,11 @@ func (p *ZincPrinter) Line(sr *starredRepositoryEdge) error {
 		"Url":            sr.Node.Url,
 		"README":         sr.Node.Object.Blob.Text,
 	}
+	// Only stars downloaded with lists have them. List names can have
+	// spaces, so they aren't joined like topics
+	if sr.Lists != nil {
+		item["Lists"] = sr.Lists
+	}
 
 	buf, err := json.Marshal(item)
 	if err != nil {
@@ -565,12 +987,69 @@ func (ZincPrinter) Flush() error {
 	return nil
 }
 
+// -- MultiPrinter
+
+// MultiPrinter prints to several printers at once, so one pass over the
+// input can write every format
+type MultiPrinter struct {
+	printers []Printer
+}
+
+func NewMultiPrinter(printers ...Printer) *MultiPrinter {
+	return &MultiPrinter{
+		printers: printers,
+	}
+}
+
+// joinErrors returns nil for no errors, the error for one error, and an error
+// listing every message for more
+func joinErrors(errs []error) error {
+	switch len(errs) {
+	case 0:
+		return nil
+	case 1:
+		return errs[0]
+	default:
+		msgs := make([]string, len(errs))
+		for i := range errs {
+			msgs[i] = errs[i].Error()
+		}
+		return fmt.Errorf("%d errors: %s", len(errs), strings.Join(msgs, "; "))
+	}
+}
+
+// each calls fn on every printer, even after one fails
+func (p *MultiPrinter) each(fn func(Printer) error) error {
+	var errs []error
+	for _, printer := range p.printers {
+		err := fn(printer)
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return joinErrors(errs)
+}
+
+func (p *MultiPrinter) Header() error {
+	return p.each(func(printer Printer) error { return printer.Header() })
+}
+
+func (p *MultiPrinter) Line(sr *starredRepositoryEdge) error {
+	return p.each(func(printer Printer) error { return printer.Line(sr) })
+}
+
+func (p *MultiPrinter) Flush() error {
+	return p.each(func(printer Printer) error { return printer.Flush() })
+}
+
+var _ Printer = new(MultiPrinter)
+
 // -- formattedDate
 
 type formattedDate struct {
 	datetime string
 	// Format can be nil to do no processing on the datetime.
-	Format *strftime.Strftime
+	Format *dateFormat
 }
 
 func (d formattedDate) MarshalJSON() ([]byte, error) {
@@ -587,117 +1066,384 @@ func (d *formattedDate) UnmarshalJSON(b []byte) error {
 	return json.Unmarshal(b, &d.datetime)
 }
 
+// String formats d like FormatString, ignoring errors, so templates can print
+// dates directly
+func (d formattedDate) String() string {
+	str, _ := d.FormatString()
+	return str
+}
+
 func (d formattedDate) Time() (time.Time, error) {
 	t, err := time.Parse(time.RFC3339, d.datetime)
 	return t, err
 }
 
 // FormatString formats d with the given format.
-// If the format is nil, it jsut returns d
+// If the format is nil (or d is empty), it jsut returns d
 func (d *formattedDate) FormatString() (string, error) {
-	if d.Format == nil {
+	if d.Format == nil || d.datetime == "" {
 		return d.datetime, nil
 	}
 	t, err := d.Time()
 	if err != nil {
 		return "", err
 	}
-	return d.Format.FormatString(t), nil
+	return d.Format.Format(t), nil
 }
 
-func format(ctx command.Context) error {
-	format := ctx.Flags["--format"].(string)
-	includeReadmes := ctx.Flags["--include-readmes"].(bool)
-	maxLineSize := ctx.Flags["--max-line-size"].(int)
-	sqliteDSN := ctx.Flags["--sqlite-dsn"].(string)
-	zincIndexName := ctx.Flags["--zinc-index-name"].(string)
+// expectDelim reads the next JSON token and checks it's delim
+func expectDelim(dec *json.Decoder, delim json.Delim) error {
+	t, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	if d, ok := t.(json.Delim); !ok || d != delim {
+		return fmt.Errorf("expected %s, got %v", delim, t)
+	}
+	return nil
+}
 
-	dateFormatStr, dateFormatStrExists := ctx.Flags["--date-format"].(string)
-	var dateFormat *strftime.Strftime
-	var err error
-	if dateFormatStrExists {
-		dateFormat, err = strftime.New(dateFormatStr)
+// walkObject calls fn for each key in the next JSON object. fn must consume
+// the key's value
+func walkObject(dec *json.Decoder, fn func(key string) error) error {
+	err := expectDelim(dec, '{')
+	if err != nil {
+		return err
+	}
+	for dec.More() {
+		t, err := dec.Token()
 		if err != nil {
-			return fmt.Errorf("--date-format error: %w", err)
+			return err
+		}
+		key, ok := t.(string)
+		if !ok {
+			return fmt.Errorf("expected object key, got %v", t)
+		}
+		err = fn(key)
+		if err != nil {
+			return err
 		}
 	}
+	return expectDelim(dec, '}')
+}
 
-	output, outputExists := ctx.Flags["--output"].(string)
-	outputFp := os.Stdout
-	if outputExists {
-		newFP, err := os.Create(output)
+// skipValue consumes the next JSON value
+func skipValue(dec *json.Decoder) error {
+	var skip json.RawMessage
+	return dec.Decode(&skip)
+}
+
+// edgeDecoders decode edges for each download file version. Version 0 is
+// files written before headers
+var edgeDecoders = map[int]func(dec *json.Decoder, edge *starredRepositoryEdge) error{
+	0: decodeEdgeV1,
+	1: decodeEdgeV1,
+}
+
+// decodeEdgeV1 decodes edges shaped like the current starredRepositoryEdge
+func decodeEdgeV1(dec *json.Decoder, edge *starredRepositoryEdge) error {
+	return dec.Decode(edge)
+}
+
+// validateDownloadHeader checks a header can be read
+func validateDownloadHeader(header *downloadHeader) error {
+	if header.Version > downloadFormatVersion {
+		return fmt.Errorf("download file version %d was written by a newer starghaze (%s). This starghaze reads up to version %d", header.Version, header.StarghazeVersion, downloadFormatVersion)
+	}
+	if _, exists := edgeDecoders[header.Version]; !exists || header.Version == 0 {
+		return fmt.Errorf("invalid download file version: %d", header.Version)
+	}
+	return nil
+}
+
+// readEdges calls fn on each starred repo in a file written by download. See
+// openInput for the inputs it can read. If onHeader isn't nil, it's called
+// before the first edge with the file's header, or nil for files written
+// before headers.
+// Download pages are one (possibly huge) JSON object per line, so edges are
+// decoded one at a time, keeping memory flat however big a page is
+func readEdges(input string, onHeader func(*downloadHeader) error, fn func(*starredRepositoryEdge) error) error {
+	inputFp, err := openInput(input)
+	if err != nil {
+		return err
+	}
+	defer inputFp.Close()
+
+	dec := json.NewDecoder(inputFp)
+	var header *downloadHeader
+	decodeEdge := edgeDecoders[0]
+	// Match keys like encoding/json does for Query
+	walkKey := func(want string, inner func() error) func(key string) error {
+		return func(key string) error {
+			if !strings.EqualFold(key, want) {
+				return skipValue(dec)
+			}
+			return inner()
+		}
+	}
+	readEdgeArray := func() error {
+		t, err := dec.Token()
 		if err != nil {
-			return fmt.Errorf("file open err: %w", err)
+			return err
+		}
+		// pages with no stars have null edges
+		if t == nil {
+			return nil
+		}
+		if d, ok := t.(json.Delim); !ok || d != '[' {
+			return fmt.Errorf("expected [, got %v", t)
 		}
-		outputFp = newFP
-		defer newFP.Close()
+		for dec.More() {
+			var edge starredRepositoryEdge
+			err := decodeEdge(dec, &edge)
+			if err != nil {
+				return err
+			}
+			err = fn(&edge)
+			if err != nil {
+				return errStopReading{err}
+			}
+		}
+		return expectDelim(dec, ']')
 	}
 
-	outputBuf := bufio.NewWriter(outputFp)
-	defer outputBuf.Flush()
-
-	var p Printer
-	switch format {
-	case "csv":
-		p = NewCSVPrinter(outputBuf)
-	case "jsonl":
-		p = NewJSONPrinter(outputBuf)
-	case "sqlite":
-		p, err = NewSqlitePrinter(sqliteDSN)
+	record := 0
+	for dec.More() {
+		record++
+		first := record == 1
+		err := walkObject(dec, func(key string) error {
+			switch {
+			case strings.EqualFold(key, downloadHeaderKey):
+				if !first {
+					return fmt.Errorf("%s header must be the first record", downloadHeaderKey)
+				}
+				header = &downloadHeader{}
+				err := dec.Decode(header)
+				if err != nil {
+					return err
+				}
+				err = validateDownloadHeader(header)
+				if err != nil {
+					return errStopReading{err}
+				}
+				decodeEdge = edgeDecoders[header.Version]
+				return nil
+			case strings.EqualFold(key, "Viewer"):
+				// call onHeader before the first edge
+				if first && onHeader != nil {
+					err := onHeader(nil)
+					if err != nil {
+						return errStopReading{err}
+					}
+				}
+				return walkObject(dec, walkKey("StarredRepositories", func() error {
+					return walkObject(dec, walkKey("Edges", readEdgeArray))
+				}))
+			default:
+				return skipValue(dec)
+			}
+		})
+		var stop errStopReading
+		if errors.As(err, &stop) {
+			return stop.err
+		}
 		if err != nil {
-			return fmt.Errorf("sql open err: %w", err)
+			return fmt.Errorf("json decode error in record %d: %w", record, err)
+		}
+		if first && header != nil && onHeader != nil {
+			err := onHeader(header)
+			if err != nil {
+				return err
+			}
 		}
-	case "zinc":
-		p = NewZincPrinter(outputBuf, zincIndexName)
-	default:
-		return fmt.Errorf("unknown output format: %s", format)
 	}
+	return nil
+}
 
-	defer p.Flush()
+// errStopReading passes errors from readEdges callbacks through unwrapped
+type errStopReading struct {
+	err error
+}
 
-	err = p.Header()
+func (e errStopReading) Error() string {
+	return e.err.Error()
+}
+
+func format(ctx command.Context) error {
+	formats, formatsExist := ctx.Flags["--format"].([]string)
+	if !formatsExist {
+		formats = []string{"csv"}
+	}
+	includeReadmes := ctx.Flags["--include-readmes"].(bool)
+	sqliteDSN := ctx.Flags["--sqlite-dsn"].(string)
+	zincIndexName := ctx.Flags["--zinc-index-name"].(string)
+	ftsTokenizer, _ := ctx.Flags["--fts-tokenizer"].(string)
+	output, outputExists := ctx.Flags["--output"].(string)
+	templateFile, templateFileExists := ctx.Flags["--template-file"].(string)
+
+	dateFormats, err := parseDateFormats(ctx.Flags)
 	if err != nil {
 		return err
 	}
 
-	// https://stackoverflow.com/a/16615559/2958070
-	input := ctx.Flags["--input"].(string)
-	inputFp, err := os.Open(input)
+	filter, err := filterFromFlags(ctx.Flags)
 	if err != nil {
-		return fmt.Errorf("file open err: %w", err)
+		return err
 	}
-	defer inputFp.Close()
 
-	scanner := bufio.NewScanner(inputFp)
+	csvOpts, err := csvOptionsFromFlags(ctx.Flags)
+	if err != nil {
+		return err
+	}
 
-	maxCapacity := maxLineSize * 1024 * 1024 // MB -> bytes
-	scannerBuf := make([]byte, maxCapacity)
-	scanner.Buffer(scannerBuf, maxCapacity)
+	// Each destination can only be written by one format
+	destinations := make(map[string]bool)
+	claim := func(destination string) error {
+		if destinations[destination] {
+			return fmt.Errorf("more than one --format writes to %s. Pass a path with FORMAT:PATH", destination)
+		}
+		destinations[destination] = true
+		return nil
+	}
 
-	var query Query
-	for scanner.Scan() {
-		err = json.Unmarshal(scanner.Bytes(), &query)
-		if err != nil {
-			return fmt.Errorf("json Unmarshal error: %w", err)
+	// openOutput opens path, or --output (stdout if not passed) if path is
+	// empty. Outputs are flushed and closed after the printers flush
+	var outputBufs []*bufio.Writer
+	var outputFps []*os.File
+	defer func() {
+		for i := range outputBufs {
+			outputBufs[i].Flush()
+			if outputFps[i] != os.Stdout {
+				outputFps[i].Close()
+			}
+		}
+	}()
+	openOutput := func(path string) (io.Writer, error) {
+		if path == "" && outputExists {
+			path = output
 		}
+		outputFp := os.Stdout
+		if path == "" {
+			if err := claim("stdout"); err != nil {
+				return nil, err
+			}
+		} else {
+			if err := claim(path); err != nil {
+				return nil, err
+			}
+			newFP, err := os.Create(path)
+			if err != nil {
+				return nil, fmt.Errorf("file open err: %w", err)
+			}
+			outputFp = newFP
+		}
+		outputBuf := bufio.NewWriter(outputFp)
+		outputBufs = append(outputBufs, outputBuf)
+		outputFps = append(outputFps, outputFp)
+		return outputBuf, nil
+	}
 
-		for i := range query.Viewer.StarredRepositories.Edges {
-			edge := query.Viewer.StarredRepositories.Edges[i]
-			edge.StarredAt.Format = dateFormat
-			edge.Node.PushedAt.Format = dateFormat
-			edge.Node.UpdatedAt.Format = dateFormat
-			if !includeReadmes {
-				edge.Node.Object.Blob.Text = ""
+	// If a later --format fails, flush the printers already built so their
+	// databases get closed
+	var printers []Printer
+	printersBuilt := false
+	defer func() {
+		if !printersBuilt {
+			for _, p := range printers {
+				_ = p.Flush()
+			}
+		}
+	}()
+	for _, f := range formats {
+		name, path, _ := strings.Cut(f, ":")
+		switch name {
+		case "csv":
+			w, err := openOutput(path)
+			if err != nil {
+				return err
+			}
+			printers = append(printers, NewCSVPrinter(w, csvOpts))
+		case "jsonl":
+			w, err := openOutput(path)
+			if err != nil {
+				return err
+			}
+			printers = append(printers, NewJSONPrinter(w))
+		case "sqlite":
+			dsn := sqliteDSN
+			if path != "" {
+				dsn = path
 			}
-			err := p.Line(&edge)
+			if err := claim("sqlite:" + dsn); err != nil {
+				return err
+			}
+			p, err := NewSqlitePrinter(dsn, ftsTokenizer)
 			if err != nil {
-				return fmt.Errorf("line print error: %w", err)
+				return fmt.Errorf("sql open err: %w", err)
 			}
+			printers = append(printers, p)
+		case "zinc":
+			w, err := openOutput(path)
+			if err != nil {
+				return err
+			}
+			printers = append(printers, NewZincPrinter(w, zincIndexName))
+		case "template":
+			if !templateFileExists {
+				return fmt.Errorf("--format template needs --template-file")
+			}
+			w, err := openOutput(path)
+			if err != nil {
+				return err
+			}
+			p, err := NewTemplatePrinter(w, templateFile)
+			if err != nil {
+				return err
+			}
+			printers = append(printers, p)
+		default:
+			return fmt.Errorf("unknown output format: %s", name)
 		}
 	}
-	err = scanner.Err()
+	printersBuilt = true
+
+	var p Printer = NewMultiPrinter(printers...)
+	if len(printers) == 1 {
+		p = printers[0]
+	}
+
+	defer p.Flush()
+
+	err = p.Header()
 	if err != nil {
-		return fmt.Errorf("scanner err: %w", err)
+		return err
 	}
-	return nil
+
+	input := ctx.Flags["--input"].(string)
+	onHeader := func(header *downloadHeader) error {
+		if includeReadmes && header != nil && !header.IncludeReadmes {
+			fmt.Fprintf(os.Stderr, "warning: --include-readmes passed, but %s was downloaded without READMEs\n", input)
+		}
+		return nil
+	}
+	return readEdges(input, onHeader, func(edge *starredRepositoryEdge) error {
+		if filter != nil {
+			keep, err := filter(edge)
+			if err != nil {
+				return fmt.Errorf("%s: filter error: %w", edge.Node.NameWithOwner, err)
+			}
+			if !keep {
+				return nil
+			}
+		}
+		dateFormats.apply(edge)
+		if !includeReadmes {
+			edge.Node.Object.Blob.Text = ""
+		}
+		err := p.Line(edge)
+		if err != nil {
+			return fmt.Errorf("line print error: %w", err)
+		}
+		return nil
+	})
 }
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestReadEdges(t *testing.T) {
+	dir := t.TempDir()
+	v1 := writeTestDownload(t, dir, "v1.jsonl", "2022-01-01T00:00:00Z",
+		testEdge("a/db", "2020-01-01T00:00:00Z", "2021-01-01T00:00:00Z", 1),
+		testEdge("b/web", "2020-02-01T00:00:00Z", "2021-01-01T00:00:00Z", 2),
+	)
+	v1Content, err := os.ReadFile(v1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeFile := func(name string, content string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0666); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	tests := []struct {
+		name       string
+		path       string
+		wantHeader bool
+		wantNames  string
+		wantErr    string
+	}{
+		{
+			name:       "v1",
+			path:       v1,
+			wantHeader: true,
+			wantNames:  "a/db,b/web",
+		},
+		{
+			name:      "v0 without a header",
+			path:      writeFile("v0.jsonl", `{"Viewer":{"StarredRepositories":{"Edges":[{"StarredAt":"2020-01-01T00:00:00Z","Node":{"NameWithOwner":"a/db"}}]}}}`+"\n"),
+			wantNames: "a/db",
+		},
+		{
+			name:    "future version",
+			path:    writeFile("future.jsonl", `{"StarghazeDownload":{"Version":99,"StarghazeVersion":"v9.0.0"}}`+"\n"),
+			wantErr: "download file version 99 was written by a newer starghaze (v9.0.0)",
+		},
+		{
+			name:    "invalid version",
+			path:    writeFile("zero.jsonl", `{"StarghazeDownload":{"Version":0}}`+"\n"),
+			wantErr: "invalid download file version: 0",
+		},
+		{
+			name:    "truncated",
+			path:    writeFile("truncated.jsonl", string(v1Content[:len(v1Content)-40])),
+			wantErr: "json decode error in record 2",
+		},
+		{
+			name:    "garbage",
+			path:    writeFile("garbage.jsonl", "not json\n"),
+			wantErr: "json decode error in record 1",
+		},
+		{
+			name:    "header after a page",
+			path:    writeFile("late-header.jsonl", `{"Viewer":{}}`+"\n"+`{"StarghazeDownload":{"Version":1}}`+"\n"),
+			wantErr: "header must be the first record",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var names []string
+			headerCalls := 0
+			var gotHeader *downloadHeader
+			err := readEdges(
+				tt.path,
+				func(header *downloadHeader) error {
+					headerCalls++
+					gotHeader = header
+					return nil
+				},
+				func(edge *starredRepositoryEdge) error {
+					names = append(names, edge.Node.NameWithOwner)
+					return nil
+				},
+			)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("want error containing %q, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if headerCalls != 1 || (gotHeader != nil) != tt.wantHeader {
+				t.Fatalf("want one onHeader call with a header: %v, got %d calls with %+v", tt.wantHeader, headerCalls, gotHeader)
+			}
+			if strings.Join(names, ",") != tt.wantNames {
+				t.Fatalf("want %s, got %s", tt.wantNames, strings.Join(names, ","))
+			}
+		})
+	}
+
+	// headerless files can be from before IsArchived was downloaded
+	repos, err := loadDiffRepos(filepath.Join(dir, "v0.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(repos) != 1 || repos[0].IsArchived != nil {
+		t.Fatalf("want unknown archived status, got %+v", repos)
+	}
+	repos, err = loadDiffRepos(v1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(repos) != 2 || repos[0].IsArchived == nil {
+		t.Fatalf("want archived status, got %+v", repos)
+	}
+}
+
+func TestSqlitePrinterRenames(t *testing.T) {
+	dsn := filepath.Join(t.TempDir(), "stars.db")
+	load := func(edges ...starredRepositoryEdge) {
+		t.Helper()
+		p, err := NewSqlitePrinter(dsn, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := p.Header(); err != nil {
+			t.Fatal(err)
+		}
+		for i := range edges {
+			if err := p.Line(&edges[i]); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := p.Flush(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	repo := func(id string, nameWithOwner string) starredRepositoryEdge {
+		edge := testEdge(nameWithOwner, "2020-01-01T00:00:00Z", "2021-01-01T00:00:00Z", 1)
+		edge.Node.PushedAt = edge.Node.UpdatedAt
+		edge.Node.ID = id
+		return edge
+	}
+	// check compares the Repo rows (by id) and the RepoAlias rows (by name)
+	check := func(wantRepos string, wantAliases string) {
+		t.Helper()
+		db, err := openSqliteDB(dsn)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer db.Close()
+		query := func(q string) string {
+			rows, err := db.Query(q)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer rows.Close()
+			var got []string
+			for rows.Next() {
+				var s string
+				if err := rows.Scan(&s); err != nil {
+					t.Fatal(err)
+				}
+				got = append(got, s)
+			}
+			if err := rows.Err(); err != nil {
+				t.Fatal(err)
+			}
+			return strings.Join(got, ",")
+		}
+		gotRepos := query(`SELECT COALESCE(NodeID, '-') || ' ' || NameWithOwner FROM Repo ORDER BY id`)
+		if gotRepos != wantRepos {
+			t.Fatalf("want repos %s, got %s", wantRepos, gotRepos)
+		}
+		gotAliases := query(`
+			SELECT a.NameWithOwner || '->' || COALESCE(r.NodeID, '-')
+			FROM RepoAlias a JOIN Repo r ON r.id = a.Repo_id
+			ORDER BY a.NameWithOwner`)
+		if gotAliases != wantAliases {
+			t.Fatalf("want aliases %s, got %s", wantAliases, gotAliases)
+		}
+	}
+
+	legacy := repo("", "d/legacy")
+	load(repo("A", "a/one"), repo("B", "b/two"), legacy)
+	check("A a/one,B b/two,- d/legacy", "")
+
+	// A and B are renamed, a new repo takes A's old name, and the row from
+	// before node IDs is matched by name
+	load(repo("A", "a/uno"), repo("B", "b/dos"), repo("C", "a/one"), repo("D", "d/legacy"))
+	check("A a/uno,B b/dos,D d/legacy,C a/one", "a/one->A,b/two->B")
+
+	// B is renamed back
+	load(repo("B", "b/two"))
+	check("A a/uno,B b/two,D d/legacy,C a/one", "a/one->A,b/dos->B")
+
+	// A and C swap names. C's name is moved aside until C is formatted
+	load(repo("A", "a/one"))
+	check("A a/one,B b/two,D d/legacy,C a/one (renamed, id 4)", "a/one->C,a/uno->A,b/dos->B")
+	load(repo("C", "a/uno"))
+	check("A a/one,B b/two,D d/legacy,C a/uno", "a/one->C,b/dos->B")
+}
@@ -5,6 +5,7 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"os"
 	"time"
 
@@ -13,12 +14,18 @@ import (
 	"golang.org/x/oauth2"
 )
 
-type starredRepositoryEdge struct {
+// githubRepositoryEdge is a starred repo as queried from GitHub
+type githubRepositoryEdge struct {
 	StarredAt formattedDate
 	Node      struct {
+		// DatabaseID is the REST API id
+		DatabaseID  int
 		Description string
 		HomepageURL string
-		Languages   struct {
+		// ID is the GraphQL node ID. Unlike NameWithOwner, it survives
+		// renames and transfers
+		ID        string
+		Languages struct {
 			Edges []struct {
 				Size int
 				Node struct {
@@ -26,6 +33,8 @@ type starredRepositoryEdge struct {
 				}
 			}
 		} `graphql:"languages(first: $maxLanguages)"`
+		IsArchived    bool
+		IsFork        bool
 		NameWithOwner string
 		Object        struct {
 			Blob struct {
@@ -47,70 +56,204 @@ type starredRepositoryEdge struct {
 	}
 }
 
+// starredRepositoryEdge is a starred repo as downloaded. It adds what isn't
+// part of the stars query
+type starredRepositoryEdge struct {
+	githubRepositoryEdge
+	// Lists are the names of the viewer's GitHub Lists the repo is in, filled
+	// from a separate lists query. nil means lists weren't downloaded
+	Lists []string
+}
+
+// pageInfo tells whether there are more stars to query
+type pageInfo struct {
+	EndCursor   githubv4.String
+	HasNextPage githubv4.Boolean
+}
+
+// starsQuery queries a page of starred repos
+type starsQuery struct {
+	Viewer struct {
+		Login               string
+		StarredRepositories struct {
+			Edges    []githubRepositoryEdge
+			PageInfo pageInfo
+		} `graphql:"starredRepositories(first: $starredRepositoryPageSize, orderBy: {field:STARRED_AT, direction:ASC}, after: $starredRepositoriesCursor)"`
+	}
+}
+
+// Query is a page of a download file
 type Query struct {
 	Viewer struct {
+		Login               string
 		StarredRepositories struct {
 			Edges    []starredRepositoryEdge
+			PageInfo pageInfo
+		}
+	}
+}
+
+// downloadOptions configure the starred repos query
+type downloadOptions struct {
+	Token          string
+	PageSize       int
+	MaxPages       int
+	IncludeLists   bool
+	IncludeReadmes bool
+	MaxLanguages   int
+	MaxRepoTopics  int
+	// AfterCursor resumes a download. nil starts from the first star
+	AfterCursor *string
+}
+
+func downloadOptionsFromFlags(ctx command.Context) downloadOptions {
+	opts := downloadOptions{
+		Token:          ctx.Flags["--token"].(string),
+		PageSize:       ctx.Flags["--page-size"].(int),
+		MaxPages:       ctx.Flags["--max-pages"].(int),
+		IncludeLists:   ctx.Flags["--include-lists"].(bool),
+		IncludeReadmes: ctx.Flags["--include-readmes"].(bool),
+		MaxLanguages:   ctx.Flags["--max-languages"].(int),
+		MaxRepoTopics:  ctx.Flags["--max-repo-topics"].(int),
+		AfterCursor:    nil,
+	}
+	afterStr, afterExists := ctx.Flags["--after-cursor"].(string)
+	if afterExists {
+		opts.AfterCursor = &afterStr
+	}
+	return opts
+}
+
+// listPageSize is how many lists, or repos in a list, to query at once. It's
+// the most GitHub allows
+const listPageSize = 100
+
+// listItems is a page of the repos in a GitHub List
+type listItems struct {
+	Nodes []struct {
+		Repository struct {
+			ID string
+		} `graphql:"... on Repository"`
+	}
+	PageInfo struct {
+		EndCursor   githubv4.String
+		HasNextPage githubv4.Boolean
+	}
+}
+
+// listsQuery queries the viewer's GitHub Lists and the first page of each
+// list's repos
+type listsQuery struct {
+	Viewer struct {
+		Lists struct {
+			Nodes []struct {
+				ID    string
+				Name  string
+				Items listItems `graphql:"items(first: $listItemsPageSize)"`
+			}
 			PageInfo struct {
 				EndCursor   githubv4.String
 				HasNextPage githubv4.Boolean
 			}
-		} `graphql:"starredRepositories(first: $starredRepositoryPageSize, orderBy: {field:STARRED_AT, direction:ASC}, after: $starredRepositoriesCursor)"`
+		} `graphql:"lists(first: $listsPageSize, after: $listsCursor)"`
 	}
 }
 
-func githubStarsDownload(ctx command.Context) error {
-	token := ctx.Flags["--token"].(string)
-	pageSize := ctx.Flags["--page-size"].(int)
-	maxPages := ctx.Flags["--max-pages"].(int)
-	timeout := ctx.Flags["--timeout"].(time.Duration)
-	includeReadmes := ctx.Flags["--include-readmes"].(bool)
-	maxLanguages := ctx.Flags["--max-languages"].(int)
-	maxRepoTopics := ctx.Flags["--max-repo-topics"].(int)
+// listItemsQuery queries more repos in a list with more than a page of them
+type listItemsQuery struct {
+	Node struct {
+		UserList struct {
+			Items listItems `graphql:"items(first: $listItemsPageSize, after: $listItemsCursor)"`
+		} `graphql:"... on UserList"`
+	} `graphql:"node(id: $listID)"`
+}
 
-	var afterPtr *string = nil
-	afterStr, afterExists := ctx.Flags["--after-cursor"].(string)
-	if afterExists {
-		afterPtr = &afterStr
+// downloadLists queries the viewer's GitHub Lists, returning the names of the
+// lists each repo is in, keyed by repo node ID
+func downloadLists(ctx context.Context, client *githubv4.Client) (map[string][]string, error) {
+	repoLists := make(map[string][]string)
+	addItems := func(listName string, items *listItems) {
+		for _, item := range items.Nodes {
+			id := item.Repository.ID
+			repoLists[id] = append(repoLists[id], listName)
+		}
 	}
 
-	outputPath := ctx.Flags["--output"].(string)
-	// https://pkg.go.dev/os?utm_source=gopls#pkg-constants
-	// return error if the file exists - NOTE: this kind of screws with any plans to append
-	fp, err := os.OpenFile(outputPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0666)
-	if err != nil {
-		return fmt.Errorf("file open err: %w", err)
+	variables := map[string]interface{}{
+		"listsCursor":       (*githubv4.String)(nil),
+		"listsPageSize":     githubv4.Int(listPageSize),
+		"listItemsPageSize": githubv4.Int(listPageSize),
 	}
-	defer fp.Close()
-
-	buf := bufio.NewWriter(fp)
-	defer buf.Flush()
+	for {
+		var query listsQuery
+		err := client.Query(ctx, &query, variables)
+		if err != nil {
+			return nil, fmt.Errorf("lists query err: %w", err)
+		}
+		for _, list := range query.Viewer.Lists.Nodes {
+			addItems(list.Name, &list.Items)
+			itemsCursor := list.Items.PageInfo.EndCursor
+			hasNextPage := list.Items.PageInfo.HasNextPage
+			for hasNextPage {
+				var itemsQuery listItemsQuery
+				err := client.Query(ctx, &itemsQuery, map[string]interface{}{
+					"listID":            githubv4.ID(list.ID),
+					"listItemsCursor":   githubv4.NewString(itemsCursor),
+					"listItemsPageSize": githubv4.Int(listPageSize),
+				})
+				if err != nil {
+					return nil, fmt.Errorf("list %s items query err: %w", list.Name, err)
+				}
+				items := &itemsQuery.Node.UserList.Items
+				addItems(list.Name, items)
+				itemsCursor = items.PageInfo.EndCursor
+				hasNextPage = items.PageInfo.HasNextPage
+			}
+		}
+		if !query.Viewer.Lists.PageInfo.HasNextPage {
+			break
+		}
+		variables["listsCursor"] = githubv4.NewString(query.Viewer.Lists.PageInfo.EndCursor)
+	}
+	return repoLists, nil
+}
 
-	timeCtx, cancel := context.WithTimeout(context.Background(), timeout)
-	defer cancel()
+// downloadPages queries starred repos a page at a time, calling fn with each
+// page. If opts.IncludeLists, the viewer's lists are queried first so each
+// edge has its list names
+func downloadPages(ctx context.Context, opts downloadOptions, fn func(*Query) error) error {
 	src := oauth2.StaticTokenSource(
 		&oauth2.Token{
-			AccessToken:  token,
+			AccessToken:  opts.Token,
 			TokenType:    "",
 			RefreshToken: "",
 			Expiry:       time.Time{},
 		},
 	)
-	httpClient := oauth2.NewClient(timeCtx, src)
+	httpClient := oauth2.NewClient(ctx, src)
 	client := githubv4.NewClient(httpClient)
 
-	var query Query
+	var repoLists map[string][]string
+	if opts.IncludeLists {
+		var err error
+		repoLists, err = downloadLists(ctx, client)
+		if err != nil {
+			return err
+		}
+	}
+
+	var query starsQuery
 
 	variables := map[string]interface{}{
-		"starredRepositoriesCursor": (*githubv4.String)(afterPtr),
-		"starredRepositoryPageSize": githubv4.NewInt(githubv4.Int(pageSize)),
-		"includeREADME":             githubv4.Boolean(includeReadmes),
-		"maxLanguages":              githubv4.Int(maxLanguages),
-		"maxRepositoryTopics":       githubv4.Int(maxRepoTopics),
+		"starredRepositoriesCursor": (*githubv4.String)(opts.AfterCursor),
+		"starredRepositoryPageSize": githubv4.NewInt(githubv4.Int(opts.PageSize)),
+		"includeREADME":             githubv4.Boolean(opts.IncludeReadmes),
+		"maxLanguages":              githubv4.Int(opts.MaxLanguages),
+		"maxRepositoryTopics":       githubv4.Int(opts.MaxRepoTopics),
 	}
 
-	for i := 0; i < maxPages; i++ {
-		err := client.Query(timeCtx, &query, variables)
+	for i := 0; i < opts.MaxPages; i++ {
+		err := client.Query(ctx, &query, variables)
 		if err != nil {
 			return fmt.Errorf(
 				"afterToken: %v , query err: %w",
@@ -119,14 +262,22 @@ func githubStarsDownload(ctx command.Context) error {
 			)
 		}
 
-		view, err := json.Marshal(&query)
-		if err != nil {
-			return fmt.Errorf("json marshall err: %w", err)
+		var page Query
+		page.Viewer.Login = query.Viewer.Login
+		page.Viewer.StarredRepositories.PageInfo = query.Viewer.StarredRepositories.PageInfo
+		page.Viewer.StarredRepositories.Edges = make([]starredRepositoryEdge, len(query.Viewer.StarredRepositories.Edges))
+		for i, edge := range query.Viewer.StarredRepositories.Edges {
+			page.Viewer.StarredRepositories.Edges[i].githubRepositoryEdge = edge
+			if opts.IncludeLists {
+				// not nil, so repos in no lists are told apart from
+				// downloads without lists
+				page.Viewer.StarredRepositories.Edges[i].Lists = append([]string{}, repoLists[edge.Node.ID]...)
+			}
 		}
-		view = append(view, byte('\n'))
-		_, err = buf.Write(view)
+
+		err = fn(&page)
 		if err != nil {
-			return fmt.Errorf("file write err: %w", err)
+			return err
 		}
 
 		if !query.Viewer.StarredRepositories.PageInfo.HasNextPage {
@@ -136,3 +287,137 @@ func githubStarsDownload(ctx command.Context) error {
 	}
 	return nil
 }
+
+// downloadFormatVersion is the version of the download file format. Bump it
+// (and teach readEdges to read the old version) when Query changes in a way
+// that old files can't be decoded as.
+// Fields added since version 1 (Node.ID, Node.DatabaseID and Lists) decode
+// from older files as their zero values, which already mean unknown, so they
+// didn't need a bump. Version 0 files can predate IsArchived and IsFork, so
+// readers that care (like diff) treat those as unknown in headerless files
+const downloadFormatVersion = 1
+
+// downloadHeaderKey is the key of the header record that starts a download
+// file. Files written before headers start with a page
+const downloadHeaderKey = "StarghazeDownload"
+
+// downloadHeader describes how a download file was fetched
+type downloadHeader struct {
+	Version          int
+	StarghazeVersion string
+	FetchedAt        string
+	Login            string
+	AfterCursor      *string
+	IncludeLists     bool
+	IncludeReadmes   bool
+	MaxLanguages     int
+	MaxRepoTopics    int
+	PageSize         int
+}
+
+// downloadHeaderFromOptions describes a download fetched now with opts
+func downloadHeaderFromOptions(opts downloadOptions) downloadHeader {
+	return downloadHeader{
+		Version:          downloadFormatVersion,
+		StarghazeVersion: getVersion(),
+		FetchedAt:        time.Now().UTC().Format(time.RFC3339),
+		Login:            "",
+		AfterCursor:      opts.AfterCursor,
+		IncludeLists:     opts.IncludeLists,
+		IncludeReadmes:   opts.IncludeReadmes,
+		MaxLanguages:     opts.MaxLanguages,
+		MaxRepoTopics:    opts.MaxRepoTopics,
+		PageSize:         opts.PageSize,
+	}
+}
+
+// downloadWriter writes a download file: a header record, then a line per
+// page
+type downloadWriter struct {
+	w             io.Writer
+	header        downloadHeader
+	headerWritten bool
+}
+
+func newDownloadWriter(w io.Writer, header downloadHeader) *downloadWriter {
+	return &downloadWriter{
+		w:             w,
+		header:        header,
+		headerWritten: false,
+	}
+}
+
+// WritePage writes a page, writing the header first if needed. The header
+// waits for the first page, which says who the viewer is if the header
+// doesn't
+func (d *downloadWriter) WritePage(query *Query) error {
+	if !d.headerWritten {
+		if d.header.Login == "" {
+			d.header.Login = query.Viewer.Login
+		}
+		line, err := json.Marshal(map[string]downloadHeader{downloadHeaderKey: d.header})
+		if err != nil {
+			return fmt.Errorf("json marshall err: %w", err)
+		}
+		line = append(line, byte('\n'))
+		_, err = d.w.Write(line)
+		if err != nil {
+			return fmt.Errorf("file write err: %w", err)
+		}
+		d.headerWritten = true
+	}
+	return writePage(d.w, query)
+}
+
+// writePage writes a page as a line of a download file
+func writePage(w io.Writer, query *Query) error {
+	view, err := json.Marshal(query)
+	if err != nil {
+		return fmt.Errorf("json marshall err: %w", err)
+	}
+	view = append(view, byte('\n'))
+	_, err = w.Write(view)
+	if err != nil {
+		return fmt.Errorf("file write err: %w", err)
+	}
+	return nil
+}
+
+func githubStarsDownload(ctx command.Context) error {
+	timeout := ctx.Flags["--timeout"].(time.Duration)
+	opts := downloadOptionsFromFlags(ctx)
+
+	outputPath := ctx.Flags["--output"].(string)
+	// https://pkg.go.dev/os?utm_source=gopls#pkg-constants
+	// return error if the file exists - NOTE: this kind of screws with any plans to append
+	fp, err := os.OpenFile(outputPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0666)
+	if err != nil {
+		return fmt.Errorf("file open err: %w", err)
+	}
+	w, err := compressWriter(outputPath, fp)
+	if err != nil {
+		return err
+	}
+
+	buf := bufio.NewWriter(w)
+	dw := newDownloadWriter(buf, downloadHeaderFromOptions(opts))
+
+	timeCtx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	err = downloadPages(timeCtx, opts, dw.WritePage)
+	// write what was downloaded even on errors, so the download can resume
+	// from the last EndCursor
+	flushErr := buf.Flush()
+	closeErr := w.Close()
+	if err != nil {
+		return err
+	}
+	if flushErr != nil {
+		return fmt.Errorf("file write err: %w", flushErr)
+	}
+	if closeErr != nil {
+		return fmt.Errorf("file close err: %w", closeErr)
+	}
+	return nil
+}
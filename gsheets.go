@@ -2,8 +2,11 @@ package main
 
 import (
 	"context"
+	"encoding/csv"
 	"fmt"
 	"os"
+	"strings"
+	"unicode/utf8"
 
 	"os/exec"
 	"runtime"
@@ -15,17 +18,18 @@ import (
 	"google.golang.org/api/sheets/v4"
 )
 
-func gSheetsOpen(ctx command.Context) error {
-	spreadsheetId := ctx.Flags["--spreadsheet-id"].(string)
-	sheetID := ctx.Flags["--sheet-id"].(int)
-
-	link := fmt.Sprintf(
-		"https://docs.google.com/spreadsheets/d/%s/edit#gid=%d",
-		spreadsheetId,
-		sheetID,
-	)
-	fmt.Printf("Opening: %s\n", link)
+// spreadsheetIDFromFlags reads --spreadsheet-id. It isn't a required flag
+// as `gsheets login` doesn't need it
+func spreadsheetIDFromFlags(ctx command.Context) (string, error) {
+	spreadsheetId, exists := ctx.Flags["--spreadsheet-id"].(string)
+	if !exists {
+		return "", fmt.Errorf("pass --spreadsheet-id or set STARGHAZE_SPREADSHEET_ID")
+	}
+	return spreadsheetId, nil
+}
 
+// openBrowser opens a link in the default browser without waiting for it
+func openBrowser(link string) error {
 	// https://stackoverflow.com/a/39324149/2958070
 	var cmd string
 	var args []string
@@ -41,47 +45,469 @@ func gSheetsOpen(ctx command.Context) error {
 	}
 	args = append(args, link)
 	return exec.Command(cmd, args...).Start()
+}
+
+func gSheetsOpen(ctx command.Context) error {
+	spreadsheetId, err := spreadsheetIDFromFlags(ctx)
+	if err != nil {
+		return err
+	}
+	sheetID, sheetIDExists := ctx.Flags["--sheet-id"].(int)
 
+	link := fmt.Sprintf(
+		"https://docs.google.com/spreadsheets/d/%s/edit",
+		spreadsheetId,
+	)
+	if sheetIDExists {
+		link += fmt.Sprintf("#gid=%d", sheetID)
+	}
+	fmt.Printf("Opening: %s\n", link)
+	return openBrowser(link)
 }
 
-func gSheetsUpload(ctx command.Context) error {
-	csvPath := ctx.Flags["--csv-path"].(string)
-	spreadsheetId := ctx.Flags["--spreadsheet-id"].(string)
-	sheetID := ctx.Flags["--sheet-id"].(int)
-	timeout := ctx.Flags["--timeout"].(time.Duration)
-	timeCtx, cancel := context.WithTimeout(context.Background(), timeout)
-	defer cancel()
+// -- SheetsPrinter
+
+// sheetsMaxCellChars is the most characters Google Sheets allows in a cell
+// https://support.google.com/drive/answer/37603
+const sheetsMaxCellChars = 50000
+
+// sheetsEpoch is day 0 for Google Sheets date serial numbers
+// https://developers.google.com/sheets/api/guides/formats#about_date_time_values
+var sheetsEpoch = time.Date(1899, time.December, 30, 0, 0, 0, 0, time.UTC)
+
+// sheetsDateToken is a token of a Google Sheets date pattern. kind tells
+// "mm" as minutes from "mm" as a month
+type sheetsDateToken struct {
+	pattern string
+	kind    string // "hour", "minute", "month", "second", "other", "literal"
+}
+
+// strftimeToSheets maps strftime verbs to Google Sheets date pattern tokens
+// https://developers.google.com/sheets/api/guides/formats#date_and_time_format_patterns
+var strftimeToSheets = map[byte][]sheetsDateToken{
+	'A': {{"dddd", "other"}},
+	'a': {{"ddd", "other"}},
+	'B': {{"mmmm", "other"}},
+	'b': {{"mmm", "other"}},
+	'd': {{"dd", "other"}},
+	'e': {{"d", "other"}},
+	'F': {{"yyyy", "other"}, {"-", "literal"}, {"mm", "month"}, {"-", "literal"}, {"dd", "other"}},
+	'H': {{"hh", "hour"}},
+	'I': {{"h", "hour"}},
+	'M': {{"mm", "minute"}},
+	'm': {{"mm", "month"}},
+	'p': {{"AM/PM", "other"}},
+	'S': {{"ss", "second"}},
+	'T': {{"hh", "hour"}, {":", "literal"}, {"mm", "minute"}, {":", "literal"}, {"ss", "second"}},
+	'Y': {{"yyyy", "other"}},
+	'y': {{"yy", "other"}},
+}
+
+// sheetsDatePattern converts a --date-format strftime string to a Google
+// Sheets date pattern. Literal text is quoted so Sheets doesn't treat it as
+// tokens. Sheets reads "mm" as minutes after hours or before seconds, and as
+// a month otherwise, so minutes and months elsewhere are errors
+func sheetsDatePattern(dateFormat string) (string, error) {
+	var tokens []sheetsDateToken
+	for i := 0; i < len(dateFormat); i++ {
+		if dateFormat[i] != '%' {
+			tokens = append(tokens, sheetsDateToken{dateFormat[i : i+1], "literal"})
+			continue
+		}
+		i++
+		if i == len(dateFormat) {
+			return "", fmt.Errorf("trailing %% in date format: %s", dateFormat)
+		}
+		if dateFormat[i] == '%' {
+			tokens = append(tokens, sheetsDateToken{"%", "literal"})
+			continue
+		}
+		verbTokens, exists := strftimeToSheets[dateFormat[i]]
+		if !exists {
+			return "", fmt.Errorf("date format verb not supported by Google Sheets: %%%c", dateFormat[i])
+		}
+		tokens = append(tokens, verbTokens...)
+	}
+
+	// neighbor returns the kind of the closest non-literal token in step's
+	// direction
+	neighbor := func(i int, step int) string {
+		for i += step; i >= 0 && i < len(tokens); i += step {
+			if tokens[i].kind != "literal" {
+				return tokens[i].kind
+			}
+		}
+		return ""
+	}
+	var b strings.Builder
+	literal := ""
+	flushLiteral := func() {
+		if literal != "" {
+			// a quote ends the quoted text, so escape it outside
+			b.WriteString(`"` + strings.ReplaceAll(literal, `"`, `"\""`) + `"`)
+			literal = ""
+		}
+	}
+	for i, t := range tokens {
+		if t.kind == "literal" {
+			literal += t.pattern
+			continue
+		}
+		readAsMinute := neighbor(i, -1) == "hour" || neighbor(i, 1) == "second"
+		if t.kind == "minute" && !readAsMinute {
+			return "", fmt.Errorf("minutes can only be shown after an hour or before seconds in Google Sheets: %s", dateFormat)
+		}
+		if t.kind == "month" && readAsMinute {
+			return "", fmt.Errorf("a month after an hour or before seconds is shown as minutes in Google Sheets: %s", dateFormat)
+		}
+		flushLiteral()
+		b.WriteString(t.pattern)
+	}
+	flushLiteral()
+	return b.String(), nil
+}
+
+// sheetsDateFormat returns the Google Sheets date pattern for f, or
+// defaultPattern if f is nil. Sheets formats dates itself, so it can't show
+// relative dates
+func sheetsDateFormat(f *dateFormat, defaultPattern string) (string, error) {
+	switch {
+	case f == nil:
+		return defaultPattern, nil
+	case f.Relative:
+		return "", fmt.Errorf("relative dates can't be shown in Google Sheets")
+	case f.Strftime != nil:
+		return sheetsDatePattern(f.Strftime.Pattern())
+	case f.Location != nil:
+		// RFC 3339, but not in UTC
+		return `yyyy-mm-dd"T"hh:mm:ss`, nil
+	default:
+		return defaultPattern, nil
+	}
+}
 
-	csvBytes, err := os.ReadFile(csvPath)
+// SheetsPrinter builds typed Google Sheets rows from csvColumns, so numbers
+// stay numbers, dates are date cells and URLs are links
+type SheetsPrinter struct {
+	rows        []*sheets.RowData
+	count       int
+	datePattern string
+}
+
+func NewSheetsPrinter(datePattern string) *SheetsPrinter {
+	return &SheetsPrinter{
+		rows:        nil,
+		count:       1,
+		datePattern: datePattern,
+	}
+}
+
+func sheetsStringCell(str string) *sheets.CellData {
+	// Sheets rejects the whole request if a cell is too long
+	if len(str) > sheetsMaxCellChars {
+		str = str[:sheetsMaxCellChars]
+		for !utf8.ValidString(str) {
+			str = str[:len(str)-1]
+		}
+	}
+	return &sheets.CellData{
+		UserEnteredValue: &sheets.ExtendedValue{StringValue: &str},
+	}
+}
+
+func (p *SheetsPrinter) cell(kind cellKind, v interface{}) (*sheets.CellData, error) {
+	switch kind {
+	case cellNumber:
+		n, ok := v.(int)
+		if !ok {
+			return nil, fmt.Errorf("expected int, got %T", v)
+		}
+		f := float64(n)
+		return &sheets.CellData{
+			UserEnteredValue: &sheets.ExtendedValue{NumberValue: &f},
+		}, nil
+	case cellDate:
+		d, ok := v.(formattedDate)
+		if !ok {
+			return nil, fmt.Errorf("expected formattedDate, got %T", v)
+		}
+		if d.datetime == "" {
+			return &sheets.CellData{}, nil
+		}
+		t, err := d.Time()
+		if err != nil {
+			return nil, err
+		}
+		// dates formatted by sync carry their own format
+		pattern, err := sheetsDateFormat(d.Format, p.datePattern)
+		if err != nil {
+			return nil, err
+		}
+		if d.Format != nil && d.Format.Location != nil {
+			// Sheets dates don't have a timezone, so shift to the wall clock time
+			_, offset := t.In(d.Format.Location).Zone()
+			t = t.Add(time.Duration(offset) * time.Second)
+		}
+		serial := float64(t.Sub(sheetsEpoch)) / float64(24*time.Hour)
+		return &sheets.CellData{
+			UserEnteredValue: &sheets.ExtendedValue{NumberValue: &serial},
+			UserEnteredFormat: &sheets.CellFormat{
+				NumberFormat: &sheets.NumberFormat{
+					Type:    "DATE_TIME",
+					Pattern: pattern,
+				},
+			},
+		}, nil
+	case cellURL:
+		str, ok := v.(string)
+		if !ok {
+			return nil, fmt.Errorf("expected string, got %T", v)
+		}
+		c := sheetsStringCell(str)
+		if str != "" {
+			c.UserEnteredFormat = &sheets.CellFormat{
+				TextFormat: &sheets.TextFormat{
+					Link: &sheets.Link{Uri: str},
+				},
+			}
+		}
+		return c, nil
+	default:
+		str, err := csvCellString(v)
+		if err != nil {
+			return nil, err
+		}
+		return sheetsStringCell(str), nil
+	}
+}
+
+func (p *SheetsPrinter) Header() error {
+	values := make([]*sheets.CellData, len(csvColumns))
+	for i := range csvColumns {
+		values[i] = sheetsStringCell(csvColumns[i].Name)
+	}
+	p.rows = append(p.rows, &sheets.RowData{Values: values})
+	return nil
+}
+
+func (p *SheetsPrinter) Line(sr *starredRepositoryEdge) error {
+	values := make([]*sheets.CellData, len(csvColumns))
+	for i := range csvColumns {
+		c, err := p.cell(csvColumns[i].Kind, csvColumns[i].Value(sr, p.count))
+		if err != nil {
+			return fmt.Errorf("%s: %s: %w", sr.Node.NameWithOwner, csvColumns[i].Name, err)
+		}
+		values[i] = c
+	}
+	p.rows = append(p.rows, &sheets.RowData{Values: values})
+	p.count++
+	return nil
+}
+
+func (SheetsPrinter) Flush() error {
+	return nil
+}
+
+// Rows returns the header and lines printed so far
+func (p *SheetsPrinter) Rows() []*sheets.RowData {
+	return p.rows
+}
+
+var _ Printer = new(SheetsPrinter)
+
+// sheetsRowsFromDownload reads a file written by download into typed rows
+func sheetsRowsFromDownload(ctx command.Context) ([]*sheets.RowData, error) {
+	input := ctx.Flags["--input"].(string)
+	includeReadmes := ctx.Flags["--include-readmes"].(bool)
+
+	dateFormats, err := parseDateFormats(ctx.Flags)
 	if err != nil {
-		return fmt.Errorf("csv read error: %s: %w", csvPath, err)
+		return nil, err
+	}
+	for _, f := range []*dateFormat{dateFormats.StarredAt, dateFormats.PushedAt, dateFormats.UpdatedAt} {
+		if _, err := sheetsDateFormat(f, ""); err != nil {
+			return nil, fmt.Errorf("date format error: %w", err)
+		}
 	}
-	csvStr := string(csvBytes)
 
-	creds, err := google.FindDefaultCredentials(timeCtx, sheets.SpreadsheetsScope)
+	p := NewSheetsPrinter(`yyyy-mm-dd"T"hh:mm:ss"Z"`)
+	err = p.Header()
 	if err != nil {
-		return fmt.Errorf("can't find default credentials: %w", err)
+		return nil, err
 	}
+	err = readEdges(input, nil, func(edge *starredRepositoryEdge) error {
+		dateFormats.apply(edge)
+		if !includeReadmes {
+			edge.Node.Object.Blob.Text = ""
+		}
+		err := p.Line(edge)
+		if err != nil {
+			return fmt.Errorf("line print error: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return p.Rows(), p.Flush()
+}
 
-	srv, err := sheets.NewService(timeCtx, option.WithCredentials(creds))
+// newSheetsService builds a Sheets client. It uses the first of:
+// --credentials-file, the token saved by `gsheets login`, or Google's
+// default credentials (GOOGLE_APPLICATION_CREDENTIALS and friends)
+func newSheetsService(ctx context.Context, credentialsFile string) (*sheets.Service, error) {
+	var opt option.ClientOption
+	if credentialsFile != "" {
+		b, err := os.ReadFile(credentialsFile)
+		if err != nil {
+			return nil, fmt.Errorf("can't read credentials file: %s: %w", credentialsFile, err)
+		}
+		creds, err := google.CredentialsFromJSON(ctx, b, sheets.SpreadsheetsScope)
+		if err != nil {
+			return nil, fmt.Errorf("can't parse credentials file: %s: %w", credentialsFile, err)
+		}
+		opt = option.WithCredentials(creds)
+	} else {
+		tokenSource, err := loginTokenSource(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if tokenSource != nil {
+			opt = option.WithTokenSource(tokenSource)
+		} else {
+			creds, err := google.FindDefaultCredentials(ctx, sheets.SpreadsheetsScope)
+			if err != nil {
+				return nil, fmt.Errorf("can't find default credentials. Run `starghaze gsheets login` or pass --credentials-file: %w", err)
+			}
+			opt = option.WithCredentials(creds)
+		}
+	}
+
+	srv, err := sheets.NewService(ctx, opt)
 	if err != nil {
-		return fmt.Errorf("unable to retrieve Sheets client: %w", err)
+		return nil, fmt.Errorf("unable to retrieve Sheets client: %w", err)
 	}
+	return srv, nil
+}
 
+// findSheet returns the properties of a sheet by ID if sheetIDExists,
+// otherwise by name. It returns nil if there's no sheet with that name
+func findSheet(ctx context.Context, srv *sheets.Service, spreadsheetId string, sheetID int, sheetIDExists bool, sheetName string) (*sheets.SheetProperties, error) {
+	spreadsheet, err := srv.Spreadsheets.Get(spreadsheetId).Fields("sheets.properties").Context(ctx).Do()
+	if err != nil {
+		return nil, fmt.Errorf("can't get spreadsheet: %w", err)
+	}
+	for _, sheet := range spreadsheet.Sheets {
+		if sheetIDExists && sheet.Properties.SheetId == int64(sheetID) {
+			return sheet.Properties, nil
+		}
+		if !sheetIDExists && sheet.Properties.Title == sheetName {
+			return sheet.Properties, nil
+		}
+	}
+	if sheetIDExists {
+		return nil, fmt.Errorf("no sheet with --sheet-id %d in spreadsheet", sheetID)
+	}
+	return nil, nil
+}
+
+// findOrAddSheet is findSheet, but creates a sheet named sheetName if needed
+func findOrAddSheet(ctx context.Context, srv *sheets.Service, spreadsheetId string, sheetID int, sheetIDExists bool, sheetName string) (*sheets.SheetProperties, error) {
+	props, err := findSheet(ctx, srv, spreadsheetId, sheetID, sheetIDExists, sheetName)
+	if err != nil || props != nil {
+		return props, err
+	}
+
+	resp, err := srv.Spreadsheets.BatchUpdate(
+		spreadsheetId,
+		&sheets.BatchUpdateSpreadsheetRequest{
+			Requests: []*sheets.Request{
+				{
+					AddSheet: &sheets.AddSheetRequest{
+						Properties: &sheets.SheetProperties{
+							Title: sheetName,
+						},
+					},
+				},
+			},
+		},
+	).Context(ctx).Do()
+	if err != nil {
+		return nil, fmt.Errorf("can't add sheet: %s: %w", sheetName, err)
+	}
+	props = resp.Replies[0].AddSheet.Properties
+	fmt.Printf("Created sheet %s with --sheet-id %d\n", props.Title, props.SheetId)
+	return props, nil
+}
+
+// csvDimensions counts the rows and the widest row in a CSV
+func csvDimensions(csvStr string) (int, int, error) {
+	r := csv.NewReader(strings.NewReader(csvStr))
+	r.FieldsPerRecord = -1
+	records, err := r.ReadAll()
+	if err != nil {
+		return 0, 0, fmt.Errorf("csv parse error: %w", err)
+	}
+	numCols := 0
+	for i := range records {
+		if len(records[i]) > numCols {
+			numCols = len(records[i])
+		}
+	}
+	return len(records), numCols, nil
+}
+
+// sheetsRowsWriteRequest writes SheetsPrinter rows to a sheet, starting at A1
+func sheetsRowsWriteRequest(sheetID int64, rows []*sheets.RowData) *sheets.Request {
+	return &sheets.Request{
+		UpdateCells: &sheets.UpdateCellsRequest{
+			Fields: "userEnteredValue,userEnteredFormat",
+			Rows:   rows,
+			Start: &sheets.GridCoordinate{
+				ColumnIndex: 0,
+				RowIndex:    0,
+				SheetId:     sheetID,
+			},
+		},
+	}
+}
+
+// sheetTargetFromFlags reads --sheet-name and --sheet-id. --sheet-name wins,
+// as --sheet-id might come from the environment
+func sheetTargetFromFlags(ctx command.Context) (int, bool, string, error) {
+	sheetID, sheetIDExists := ctx.Flags["--sheet-id"].(int)
+	sheetName, sheetNameExists := ctx.Flags["--sheet-name"].(string)
+	if sheetNameExists {
+		sheetIDExists = false
+	}
+	if !sheetIDExists && !sheetNameExists {
+		return 0, false, "", fmt.Errorf("pass --sheet-id or --sheet-name")
+	}
+	return sheetID, sheetIDExists, sheetName, nil
+}
+
+// sheetLayout is how gSheetsOverwrite tidies a sheet after writing it
+type sheetLayout struct {
+	AutoFilter    bool
+	FormatColumns bool
+	FreezeHeader  bool
+	// Resize shrinks the grid to fit the data. Otherwise it only grows
+	Resize bool
+}
+
+// gSheetsOverwrite erases a sheet, writes writeRequest (numRows x numCols
+// starting at A1) to it, and applies layout
+func gSheetsOverwrite(ctx context.Context, srv *sheets.Service, spreadsheetId string, sheetProps *sheets.SheetProperties, writeRequest *sheets.Request, numRows int, numCols int, layout sheetLayout) error {
 	requests := []*sheets.Request{
-		// Erase current cells
+		// Erase current cells. A GridRange with only a SheetId is the whole sheet
 		// https://stackoverflow.com/q/37928947/2958070
 		{
 			UpdateCells: &sheets.UpdateCellsRequest{
 				Fields: "*",
 				Range: &sheets.GridRange{
-					SheetId:          0, // TODO: test this...
-					EndColumnIndex:   0,
-					EndRowIndex:      0,
-					StartColumnIndex: 0,
-					StartRowIndex:    0,
-					ForceSendFields:  nil,
-					NullFields:       nil,
+					SheetId:         sheetProps.SheetId,
+					ForceSendFields: nil,
+					NullFields:      nil,
 				},
 				Rows:            nil,
 				Start:           nil,
@@ -89,25 +515,101 @@ func gSheetsUpload(ctx command.Context) error {
 				NullFields:      nil,
 			},
 		},
-		// https://stackoverflow.com/q/42362702/2958070
-		{
-			PasteData: &sheets.PasteDataRequest{
-				Coordinate: &sheets.GridCoordinate{
-					ColumnIndex: 0,
-					RowIndex:    0,
-					// https://developers.google.com/sheets/api/guides/concepts
-					SheetId:         int64(sheetID), // TODO: prefer reading an int64 flag, not casting :)
-					ForceSendFields: nil,
-					NullFields:      nil,
+	}
+
+	// Size the grid before writing: UpdateCells can't write past the grid
+	gridProps := &sheets.GridProperties{}
+	gridFields := []string{}
+	if layout.Resize || int64(numRows) > sheetProps.GridProperties.RowCount {
+		gridProps.RowCount = int64(numRows)
+		gridFields = append(gridFields, "gridProperties.rowCount")
+	}
+	if layout.Resize || int64(numCols) > sheetProps.GridProperties.ColumnCount {
+		gridProps.ColumnCount = int64(numCols)
+		gridFields = append(gridFields, "gridProperties.columnCount")
+	}
+	if layout.FreezeHeader {
+		gridProps.FrozenRowCount = 1
+		gridFields = append(gridFields, "gridProperties.frozenRowCount")
+	}
+	if len(gridFields) > 0 {
+		requests = append(requests, &sheets.Request{
+			UpdateSheetProperties: &sheets.UpdateSheetPropertiesRequest{
+				Fields: strings.Join(gridFields, ","),
+				Properties: &sheets.SheetProperties{
+					SheetId:        sheetProps.SheetId,
+					GridProperties: gridProps,
 				},
-				Data:            csvStr,
-				Delimiter:       ",",
-				Type:            "PASTE_NORMAL",
-				Html:            false,
-				ForceSendFields: nil,
-				NullFields:      nil,
 			},
-		},
+		})
+	}
+
+	requests = append(requests, writeRequest)
+
+	dataRange := &sheets.GridRange{
+		SheetId:          sheetProps.SheetId,
+		StartRowIndex:    0,
+		EndRowIndex:      int64(numRows),
+		StartColumnIndex: 0,
+		EndColumnIndex:   int64(numCols),
+	}
+
+	if layout.AutoFilter {
+		requests = append(requests, &sheets.Request{
+			SetBasicFilter: &sheets.SetBasicFilterRequest{
+				Filter: &sheets.BasicFilter{
+					Range: dataRange,
+				},
+			},
+		})
+	}
+
+	if layout.FormatColumns {
+		requests = append(requests,
+			// Clip long cells (like READMEs) instead of making giant rows
+			&sheets.Request{
+				RepeatCell: &sheets.RepeatCellRequest{
+					Range: dataRange,
+					Cell: &sheets.CellData{
+						UserEnteredFormat: &sheets.CellFormat{
+							WrapStrategy:      "CLIP",
+							VerticalAlignment: "TOP",
+						},
+					},
+					Fields: "userEnteredFormat.wrapStrategy,userEnteredFormat.verticalAlignment",
+				},
+			},
+			// Bold header
+			&sheets.Request{
+				RepeatCell: &sheets.RepeatCellRequest{
+					Range: &sheets.GridRange{
+						SheetId:          sheetProps.SheetId,
+						StartRowIndex:    0,
+						EndRowIndex:      1,
+						StartColumnIndex: 0,
+						EndColumnIndex:   int64(numCols),
+					},
+					Cell: &sheets.CellData{
+						UserEnteredFormat: &sheets.CellFormat{
+							TextFormat: &sheets.TextFormat{
+								Bold: true,
+							},
+						},
+					},
+					Fields: "userEnteredFormat.textFormat.bold",
+				},
+			},
+			&sheets.Request{
+				AutoResizeDimensions: &sheets.AutoResizeDimensionsRequest{
+					Dimensions: &sheets.DimensionRange{
+						SheetId:    sheetProps.SheetId,
+						Dimension:  "COLUMNS",
+						StartIndex: 0,
+						EndIndex:   int64(numCols),
+					},
+				},
+			},
+		)
 	}
 
 	rb := &sheets.BatchUpdateSpreadsheetRequest{
@@ -122,7 +624,7 @@ func gSheetsUpload(ctx command.Context) error {
 	resp, err := srv.Spreadsheets.BatchUpdate(
 		spreadsheetId,
 		rb,
-	).Context(timeCtx).Do()
+	).Context(ctx).Do()
 	if err != nil {
 		return fmt.Errorf("batch error failure: %w", err)
 	}
@@ -130,3 +632,134 @@ func gSheetsUpload(ctx command.Context) error {
 	fmt.Printf("Status Code: %d\n", resp.HTTPStatusCode)
 	return nil
 }
+
+func gSheetsUpload(ctx command.Context) error {
+	csvPath, csvPathExists := ctx.Flags["--csv-path"].(string)
+	_, inputExists := ctx.Flags["--input"].(string)
+	credentialsFile, _ := ctx.Flags["--credentials-file"].(string)
+	autoFilter := ctx.Flags["--auto-filter"].(bool)
+	formatColumns := ctx.Flags["--format-columns"].(bool)
+	freezeHeader := ctx.Flags["--freeze-header"].(bool)
+	resize := ctx.Flags["--resize"].(bool)
+	sync := ctx.Flags["--sync"].(bool)
+	withDashboard := ctx.Flags["--with-dashboard"].(bool)
+	dashboardName := ctx.Flags["--dashboard-sheet-name"].(string)
+	dashboardTop := ctx.Flags["--dashboard-top"].(int)
+	timeout := ctx.Flags["--timeout"].(time.Duration)
+	timeCtx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	spreadsheetId, err := spreadsheetIDFromFlags(ctx)
+	if err != nil {
+		return err
+	}
+	if csvPathExists == inputExists {
+		return fmt.Errorf("pass exactly one of --csv-path or --input")
+	}
+	if sync && !inputExists {
+		return fmt.Errorf("--sync needs --input")
+	}
+	if sync && (autoFilter || formatColumns || freezeHeader || resize) {
+		return fmt.Errorf("--sync only updates cells. Don't combine it with --auto-filter, --format-columns, --freeze-header or --resize")
+	}
+	// the dashboard relies on the column layout and cell types of --input
+	if withDashboard && (!inputExists || sync) {
+		return fmt.Errorf("--with-dashboard needs --input and can't be combined with --sync")
+	}
+	if dashboardTop < 1 {
+		return fmt.Errorf("--dashboard-top must be positive: %d", dashboardTop)
+	}
+
+	sheetID, sheetIDExists, sheetName, err := sheetTargetFromFlags(ctx)
+	if err != nil {
+		return err
+	}
+
+	srv, err := newSheetsService(timeCtx, credentialsFile)
+	if err != nil {
+		return err
+	}
+
+	sheetProps, err := findOrAddSheet(timeCtx, srv, spreadsheetId, sheetID, sheetIDExists, sheetName)
+	if err != nil {
+		return err
+	}
+	if sheetProps.GridProperties == nil {
+		return fmt.Errorf("can't upload to non-grid sheet: %s", sheetProps.Title)
+	}
+	targetSheetID := sheetProps.SheetId
+
+	if sync {
+		rows, err := sheetsRowsFromDownload(ctx)
+		if err != nil {
+			return err
+		}
+		return gSheetsSync(timeCtx, srv, spreadsheetId, sheetProps, rows)
+	}
+
+	// https://stackoverflow.com/q/42362702/2958070
+	var writeRequest *sheets.Request
+	var numRows, numCols int
+	var rows []*sheets.RowData
+	if inputExists {
+		rows, err = sheetsRowsFromDownload(ctx)
+		if err != nil {
+			return err
+		}
+		numRows = len(rows)
+		numCols = len(csvColumns)
+		writeRequest = sheetsRowsWriteRequest(targetSheetID, rows)
+	} else {
+		csvBytes, err := os.ReadFile(csvPath)
+		if err != nil {
+			return fmt.Errorf("csv read error: %s: %w", csvPath, err)
+		}
+		csvStr := string(csvBytes)
+		numRows, numCols, err = csvDimensions(csvStr)
+		if err != nil {
+			return fmt.Errorf("%s: %w", csvPath, err)
+		}
+		writeRequest = &sheets.Request{
+			PasteData: &sheets.PasteDataRequest{
+				Coordinate: &sheets.GridCoordinate{
+					ColumnIndex: 0,
+					RowIndex:    0,
+					// https://developers.google.com/sheets/api/guides/concepts
+					SheetId:         targetSheetID,
+					ForceSendFields: nil,
+					NullFields:      nil,
+				},
+				Data:            csvStr,
+				Delimiter:       ",",
+				Type:            "PASTE_NORMAL",
+				Html:            false,
+				ForceSendFields: nil,
+				NullFields:      nil,
+			},
+		}
+	}
+
+	err = gSheetsOverwrite(
+		timeCtx,
+		srv,
+		spreadsheetId,
+		sheetProps,
+		writeRequest,
+		numRows,
+		numCols,
+		sheetLayout{
+			AutoFilter:    autoFilter,
+			FormatColumns: formatColumns,
+			FreezeHeader:  freezeHeader,
+			Resize:        resize,
+		},
+	)
+	if err != nil {
+		return err
+	}
+
+	if withDashboard {
+		return gSheetsDashboard(timeCtx, srv, spreadsheetId, sheetProps, rows, dashboardName, dashboardTop)
+	}
+	return nil
+}
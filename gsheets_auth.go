@@ -0,0 +1,222 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"go.bbkane.com/warg/command"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+	"google.golang.org/api/sheets/v4"
+)
+
+// loginCache is what `gsheets login` saves. The client secret is saved with
+// the token so the token can be refreshed without passing it again
+type loginCache struct {
+	ClientSecret json.RawMessage `json:"client_secret"`
+	Token        *oauth2.Token   `json:"token"`
+}
+
+// loginCachePath is where `gsheets login` saves its token
+func loginCachePath() (string, error) {
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("can't find user config dir: %w", err)
+	}
+	return filepath.Join(configDir, "starghaze", "gsheets_token.json"), nil
+}
+
+// loginTokenSource returns a token source from the token saved by
+// `gsheets login`, or nil if there isn't one
+func loginTokenSource(ctx context.Context) (oauth2.TokenSource, error) {
+	cachePath, err := loginCachePath()
+	if err != nil {
+		return nil, err
+	}
+	b, err := os.ReadFile(cachePath)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("can't read login token: %s: %w", cachePath, err)
+	}
+	var cache loginCache
+	err = json.Unmarshal(b, &cache)
+	if err != nil {
+		return nil, fmt.Errorf("can't parse login token: %s: %w", cachePath, err)
+	}
+	config, err := google.ConfigFromJSON(cache.ClientSecret, sheets.SpreadsheetsScope)
+	if err != nil {
+		return nil, fmt.Errorf("can't parse client secret in login token: %s: %w", cachePath, err)
+	}
+	return config.TokenSource(ctx, cache.Token), nil
+}
+
+// randomURLString returns n random bytes, base64url encoded
+func randomURLString(n int) (string, error) {
+	b := make([]byte, n)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", fmt.Errorf("can't generate random string: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// gSheetsLogin runs the installed app OAuth flow: Google redirects to a
+// server listening on a loopback port, and the token is saved to the user
+// config dir
+// https://developers.google.com/identity/protocols/oauth2/native-app
+func gSheetsLogin(ctx command.Context) error {
+	clientSecretFile := ctx.Flags["--client-secret-file"].(string)
+	timeout := ctx.Flags["--timeout"].(time.Duration)
+	timeCtx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	clientSecret, err := os.ReadFile(clientSecretFile)
+	if err != nil {
+		return fmt.Errorf("can't read client secret file: %s: %w", clientSecretFile, err)
+	}
+	config, err := google.ConfigFromJSON(clientSecret, sheets.SpreadsheetsScope)
+	if err != nil {
+		return fmt.Errorf("can't parse client secret file. Download it from a Desktop app OAuth client: %s: %w", clientSecretFile, err)
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return fmt.Errorf("can't listen for the OAuth redirect: %w", err)
+	}
+	config.RedirectURL = fmt.Sprintf("http://127.0.0.1:%d/", listener.Addr().(*net.TCPAddr).Port)
+
+	state, err := randomURLString(16)
+	if err != nil {
+		return err
+	}
+	// PKCE: https://datatracker.ietf.org/doc/html/rfc7636
+	verifier, err := randomURLString(32)
+	if err != nil {
+		return err
+	}
+	challenge := sha256.Sum256([]byte(verifier))
+
+	type result struct {
+		code string
+		err  error
+	}
+	results := make(chan result, 1)
+	server := &http.Server{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			query := r.URL.Query()
+			var res result
+			switch {
+			case query.Get("state") != state:
+				// probably not a redirect from Google. Keep waiting
+				http.Error(w, "state mismatch", http.StatusBadRequest)
+				return
+			case query.Get("error") != "":
+				res.err = fmt.Errorf("authorization failed: %s", query.Get("error"))
+			default:
+				res.code = query.Get("code")
+			}
+			if res.err != nil {
+				fmt.Fprintln(w, "Login failed. Check the terminal for details.")
+			} else {
+				fmt.Fprintln(w, "Logged in to starghaze. You can close this tab.")
+			}
+			select {
+			case results <- res:
+			default:
+			}
+		}),
+	}
+	go func() {
+		// Serve always returns an error after Close
+		_ = server.Serve(listener)
+	}()
+	defer func() {
+		_ = server.Close()
+	}()
+
+	authURL := config.AuthCodeURL(
+		state,
+		oauth2.AccessTypeOffline,
+		// ask for consent every time so Google returns a refresh token
+		oauth2.ApprovalForce,
+		oauth2.SetAuthURLParam("code_challenge", base64.RawURLEncoding.EncodeToString(challenge[:])),
+		oauth2.SetAuthURLParam("code_challenge_method", "S256"),
+	)
+	fmt.Printf("Opening: %s\n", authURL)
+	err = openBrowser(authURL)
+	if err != nil {
+		fmt.Println("Can't open a browser. Visit the link above to log in")
+	}
+
+	var res result
+	select {
+	case res = <-results:
+	case <-timeCtx.Done():
+		return fmt.Errorf("timed out waiting for login: %w", timeCtx.Err())
+	}
+	if res.err != nil {
+		return res.err
+	}
+
+	token, err := config.Exchange(
+		timeCtx,
+		res.code,
+		oauth2.SetAuthURLParam("code_verifier", verifier),
+	)
+	if err != nil {
+		return fmt.Errorf("can't exchange authorization code: %w", err)
+	}
+
+	cacheBytes, err := json.MarshalIndent(
+		loginCache{ClientSecret: clientSecret, Token: token},
+		"",
+		"  ",
+	)
+	if err != nil {
+		return fmt.Errorf("can't marshal login token: %w", err)
+	}
+	cachePath, err := loginCachePath()
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(filepath.Dir(cachePath), 0700)
+	if err != nil {
+		return fmt.Errorf("can't create config dir: %w", err)
+	}
+	err = os.WriteFile(cachePath, cacheBytes, 0600)
+	if err != nil {
+		return fmt.Errorf("can't save login token: %s: %w", cachePath, err)
+	}
+	fmt.Printf("Saved login token to %s\n", cachePath)
+	return nil
+}
+
+// gSheetsLogout deletes the token saved by `gsheets login`
+func gSheetsLogout(ctx command.Context) error {
+	cachePath, err := loginCachePath()
+	if err != nil {
+		return err
+	}
+	err = os.Remove(cachePath)
+	if errors.Is(err, os.ErrNotExist) {
+		fmt.Println("Not logged in")
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("can't delete login token: %s: %w", cachePath, err)
+	}
+	fmt.Printf("Deleted login token %s\n", cachePath)
+	return nil
+}
@@ -0,0 +1,284 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"google.golang.org/api/sheets/v4"
+)
+
+// Dashboard tab layout. Pivot tables go in the first columns, charts float
+// to their right, and the language and topic lists the pivot tables count
+// are written one per row in the helper columns
+const (
+	dashboardMonthCol    = 0
+	dashboardLanguageCol = 3
+	dashboardTopicCol    = 6
+	dashboardChartCol    = 9
+	// charts are about 20 rows tall
+	dashboardChartRows      = 20
+	dashboardHelperLangCol  = 20
+	dashboardHelperTopicCol = 21
+	dashboardMinColumnCount = dashboardHelperTopicCol + 1
+	dashboardMinRowCount    = 3 * dashboardChartRows
+)
+
+// splitCell returns the space separated words in a string cell
+func splitCell(row *sheets.RowData, col int) []string {
+	value := row.Values[col].UserEnteredValue
+	if value == nil || value.StringValue == nil {
+		return nil
+	}
+	return strings.Fields(*value.StringValue)
+}
+
+// dashboardPivot counts the values in a single column range, grouped by
+// value
+func dashboardPivot(source *sheets.GridRange, label string, group *sheets.PivotGroup) *sheets.CellData {
+	group.Label = label
+	group.SourceColumnOffset = 0
+	return &sheets.CellData{
+		PivotTable: &sheets.PivotTable{
+			Source: source,
+			Rows:   []*sheets.PivotGroup{group},
+			Values: []*sheets.PivotValue{
+				{
+					Name:               "Stars",
+					SourceColumnOffset: 0,
+					SummarizeFunction:  "COUNTA",
+				},
+			},
+		},
+	}
+}
+
+// dashboardChart charts the first numRows rows of a pivot table written at
+// pivotCol
+func dashboardChart(sheetID int64, title string, chartType string, pivotCol int, numRows int, anchorRow int) *sheets.Request {
+	column := func(col int) *sheets.ChartData {
+		return &sheets.ChartData{
+			SourceRange: &sheets.ChartSourceRange{
+				Sources: []*sheets.GridRange{
+					{
+						SheetId:          sheetID,
+						StartRowIndex:    0,
+						EndRowIndex:      int64(numRows),
+						StartColumnIndex: int64(col),
+						EndColumnIndex:   int64(col + 1),
+					},
+				},
+			},
+		}
+	}
+	// bar charts are sideways
+	valueAxis := "LEFT_AXIS"
+	if chartType == "BAR" {
+		valueAxis = "BOTTOM_AXIS"
+	}
+	return &sheets.Request{
+		AddChart: &sheets.AddChartRequest{
+			Chart: &sheets.EmbeddedChart{
+				Spec: &sheets.ChartSpec{
+					Title: title,
+					BasicChart: &sheets.BasicChartSpec{
+						ChartType:      chartType,
+						HeaderCount:    1,
+						LegendPosition: "NO_LEGEND",
+						Domains: []*sheets.BasicChartDomain{
+							{Domain: column(pivotCol)},
+						},
+						Series: []*sheets.BasicChartSeries{
+							{Series: column(pivotCol + 1), TargetAxis: valueAxis},
+						},
+					},
+				},
+				Position: &sheets.EmbeddedObjectPosition{
+					OverlayPosition: &sheets.OverlayPosition{
+						AnchorCell: &sheets.GridCoordinate{
+							SheetId:     sheetID,
+							RowIndex:    int64(anchorRow),
+							ColumnIndex: dashboardChartCol,
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+// gSheetsDashboard creates or refreshes a tab with pivot tables and charts of
+// stars per month, top languages and top topics, built from the sheet
+// uploaded from downloadRows
+func gSheetsDashboard(ctx context.Context, srv *sheets.Service, spreadsheetId string, dataSheet *sheets.SheetProperties, downloadRows []*sheets.RowData, dashboardName string, top int) error {
+	if dashboardName == dataSheet.Title {
+		return fmt.Errorf("the dashboard can't replace the uploaded sheet: %s", dashboardName)
+	}
+
+	spreadsheet, err := srv.Spreadsheets.Get(spreadsheetId).Fields("sheets(properties,charts(chartId))").Context(ctx).Do()
+	if err != nil {
+		return fmt.Errorf("can't get spreadsheet: %w", err)
+	}
+	var dashboard *sheets.Sheet
+	for _, sheet := range spreadsheet.Sheets {
+		if sheet.Properties.Title == dashboardName {
+			dashboard = sheet
+		}
+	}
+	if dashboard == nil {
+		resp, err := srv.Spreadsheets.BatchUpdate(
+			spreadsheetId,
+			&sheets.BatchUpdateSpreadsheetRequest{
+				Requests: []*sheets.Request{
+					{
+						AddSheet: &sheets.AddSheetRequest{
+							Properties: &sheets.SheetProperties{Title: dashboardName},
+						},
+					},
+				},
+			},
+		).Context(ctx).Do()
+		if err != nil {
+			return fmt.Errorf("can't add dashboard sheet: %s: %w", dashboardName, err)
+		}
+		dashboard = &sheets.Sheet{Properties: resp.Replies[0].AddSheet.Properties}
+	}
+	if dashboard.Properties.GridProperties == nil {
+		return fmt.Errorf("can't replace non-grid sheet with dashboard: %s", dashboardName)
+	}
+	dashboardID := dashboard.Properties.SheetId
+
+	// One row per language and topic, so pivot tables can count them
+	languageCol := csvColumnIndex("Languages")
+	topicCol := csvColumnIndex("Topics")
+	languageRows := []*sheets.RowData{{Values: []*sheets.CellData{sheetsStringCell("Language")}}}
+	topicRows := []*sheets.RowData{{Values: []*sheets.CellData{sheetsStringCell("Topic")}}}
+	for _, row := range downloadRows[1:] {
+		for _, language := range splitCell(row, languageCol) {
+			languageRows = append(languageRows, &sheets.RowData{Values: []*sheets.CellData{sheetsStringCell(language)}})
+		}
+		for _, topic := range splitCell(row, topicCol) {
+			topicRows = append(topicRows, &sheets.RowData{Values: []*sheets.CellData{sheetsStringCell(topic)}})
+		}
+	}
+
+	requests := []*sheets.Request{}
+	for _, chart := range dashboard.Charts {
+		requests = append(requests, &sheets.Request{
+			DeleteEmbeddedObject: &sheets.DeleteEmbeddedObjectRequest{
+				ObjectId: chart.ChartId,
+			},
+		})
+	}
+	// Clearing every field removes old pivot tables too
+	requests = append(requests, &sheets.Request{
+		UpdateCells: &sheets.UpdateCellsRequest{
+			Fields: "*",
+			Range:  &sheets.GridRange{SheetId: dashboardID},
+		},
+	})
+
+	neededRows := int64(dashboardMinRowCount)
+	for _, n := range []int{len(downloadRows), len(languageRows), len(topicRows)} {
+		if int64(n) > neededRows {
+			neededRows = int64(n)
+		}
+	}
+	gridProps := &sheets.GridProperties{}
+	gridFields := []string{}
+	if neededRows > dashboard.Properties.GridProperties.RowCount {
+		gridProps.RowCount = neededRows
+		gridFields = append(gridFields, "gridProperties.rowCount")
+	}
+	if dashboardMinColumnCount > dashboard.Properties.GridProperties.ColumnCount {
+		gridProps.ColumnCount = dashboardMinColumnCount
+		gridFields = append(gridFields, "gridProperties.columnCount")
+	}
+	if len(gridFields) > 0 {
+		requests = append(requests, &sheets.Request{
+			UpdateSheetProperties: &sheets.UpdateSheetPropertiesRequest{
+				Fields: strings.Join(gridFields, ","),
+				Properties: &sheets.SheetProperties{
+					SheetId:        dashboardID,
+					GridProperties: gridProps,
+				},
+			},
+		})
+	}
+
+	writeColumn := func(col int, fields string, rows []*sheets.RowData) {
+		requests = append(requests, &sheets.Request{
+			UpdateCells: &sheets.UpdateCellsRequest{
+				Fields: fields,
+				Rows:   rows,
+				Start: &sheets.GridCoordinate{
+					SheetId:     dashboardID,
+					RowIndex:    0,
+					ColumnIndex: int64(col),
+				},
+			},
+		})
+	}
+	writeColumn(dashboardHelperLangCol, "userEnteredValue", languageRows)
+	writeColumn(dashboardHelperTopicCol, "userEnteredValue", topicRows)
+
+	singleColumn := func(sheetID int64, col int, numRows int) *sheets.GridRange {
+		return &sheets.GridRange{
+			SheetId:          sheetID,
+			StartRowIndex:    0,
+			EndRowIndex:      int64(numRows),
+			StartColumnIndex: int64(col),
+			EndColumnIndex:   int64(col + 1),
+		}
+	}
+	topGroup := func() *sheets.PivotGroup {
+		return &sheets.PivotGroup{
+			SortOrder:   "DESCENDING",
+			ValueBucket: &sheets.PivotGroupSortValueBucket{},
+			GroupLimit:  &sheets.PivotGroupLimit{CountLimit: int64(top)},
+		}
+	}
+	writePivot := func(col int, pivot *sheets.CellData) {
+		writeColumn(col, "pivotTable", []*sheets.RowData{{Values: []*sheets.CellData{pivot}}})
+	}
+	writePivot(dashboardMonthCol, dashboardPivot(
+		singleColumn(dataSheet.SheetId, csvColumnIndex("StarredAt"), len(downloadRows)),
+		"Month",
+		&sheets.PivotGroup{
+			SortOrder: "ASCENDING",
+			GroupRule: &sheets.PivotGroupRule{
+				DateTimeRule: &sheets.DateTimeRule{Type: "YEAR_MONTH"},
+			},
+		},
+	))
+	writePivot(dashboardLanguageCol, dashboardPivot(
+		singleColumn(dashboardID, dashboardHelperLangCol, len(languageRows)),
+		"Language",
+		topGroup(),
+	))
+	writePivot(dashboardTopicCol, dashboardPivot(
+		singleColumn(dashboardID, dashboardHelperTopicCol, len(topicRows)),
+		"Topic",
+		topGroup(),
+	))
+
+	// Pivot tables fill in after this batch, so chart as many rows as
+	// they could have
+	requests = append(requests,
+		dashboardChart(dashboardID, "Stars per month", "COLUMN", dashboardMonthCol, len(downloadRows), 0),
+		dashboardChart(dashboardID, "Top languages", "BAR", dashboardLanguageCol, top+1, dashboardChartRows),
+		dashboardChart(dashboardID, "Top topics", "BAR", dashboardTopicCol, top+1, 2*dashboardChartRows),
+	)
+
+	_, err = srv.Spreadsheets.BatchUpdate(
+		spreadsheetId,
+		&sheets.BatchUpdateSpreadsheetRequest{
+			Requests: requests,
+		},
+	).Context(ctx).Do()
+	if err != nil {
+		return fmt.Errorf("dashboard batch error failure: %w", err)
+	}
+	fmt.Printf("Refreshed dashboard sheet %s\n", dashboardName)
+	return nil
+}
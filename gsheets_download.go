@@ -0,0 +1,185 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"go.bbkane.com/warg/command"
+)
+
+// gSheetsDownload reads annotation columns (notes, tags, ratings, ...) from
+// a sheet and merges them into RepoAnnotation, matched by NameWithOwner.
+// Empty cells delete the annotation so notes cleared in the sheet disappear
+// from the database too.
+func gSheetsDownload(ctx command.Context) error {
+	columns := ctx.Flags["--column"].([]string)
+	dsn := ctx.Flags["--sqlite-dsn"].(string)
+	keyColumn := ctx.Flags["--key-column"].(string)
+	credentialsFile, _ := ctx.Flags["--credentials-file"].(string)
+	sheetID, sheetIDExists := ctx.Flags["--sheet-id"].(int)
+	sheetName, sheetNameExists := ctx.Flags["--sheet-name"].(string)
+	readRange, readRangeExists := ctx.Flags["--range"].(string)
+	timeout := ctx.Flags["--timeout"].(time.Duration)
+	timeCtx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	spreadsheetId, err := spreadsheetIDFromFlags(ctx)
+	if err != nil {
+		return err
+	}
+
+	srv, err := newSheetsService(timeCtx, credentialsFile)
+	if err != nil {
+		return err
+	}
+
+	// --range wins, then --sheet-name, as --sheet-id might come from the environment
+	if !readRangeExists {
+		if sheetNameExists {
+			sheetIDExists = false
+		}
+		if !sheetIDExists && !sheetNameExists {
+			return fmt.Errorf("pass --range, --sheet-name or --sheet-id")
+		}
+		sheetProps, err := findSheet(timeCtx, srv, spreadsheetId, sheetID, sheetIDExists, sheetName)
+		if err != nil {
+			return err
+		}
+		if sheetProps == nil {
+			return fmt.Errorf("no sheet named %s in spreadsheet", sheetName)
+		}
+		readRange = quoteSheetTitle(sheetProps.Title)
+	}
+
+	resp, err := srv.Spreadsheets.Values.Get(
+		spreadsheetId,
+		readRange,
+	).ValueRenderOption("FORMATTED_VALUE").Context(timeCtx).Do()
+	if err != nil {
+		return fmt.Errorf("can't read range %s: %w", readRange, err)
+	}
+	if len(resp.Values) == 0 {
+		return fmt.Errorf("range %s is empty", readRange)
+	}
+
+	header := resp.Values[0]
+	findColumn := func(name string) (int, error) {
+		for i := range header {
+			if strings.EqualFold(cellText(header, i), name) {
+				return i, nil
+			}
+		}
+		return 0, fmt.Errorf("no %s column in the header row of %s", name, readRange)
+	}
+	keyCol, err := findColumn(keyColumn)
+	if err != nil {
+		return err
+	}
+	annotationCols := make([]int, len(columns))
+	for i, name := range columns {
+		annotationCols[i], err = findColumn(name)
+		if err != nil {
+			return err
+		}
+	}
+
+	db, err := openSqliteDB(dsn)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	var upserted, deleted, unknownRepos int
+	now := time.Now()
+	err = withTx(
+		db,
+		func(tx *sql.Tx) error {
+			for _, row := range resp.Values[1:] {
+				nameWithOwner := strings.TrimSpace(cellText(row, keyCol))
+				if nameWithOwner == "" {
+					continue
+				}
+				var repoID int
+				err := tx.QueryRowContext(
+					timeCtx,
+					`SELECT id FROM Repo WHERE NameWithOwner = ?`,
+					nameWithOwner,
+				).Scan(&repoID)
+				if err == sql.ErrNoRows {
+					unknownRepos++
+					continue
+				}
+				if err != nil {
+					return fmt.Errorf("repo select err: %s: %w", nameWithOwner, err)
+				}
+
+				for i, name := range columns {
+					value := strings.TrimSpace(cellText(row, annotationCols[i]))
+					if value == "" {
+						res, err := tx.ExecContext(
+							timeCtx,
+							`DELETE FROM RepoAnnotation WHERE Repo_id = ? AND Name = ?`,
+							repoID,
+							name,
+						)
+						if err != nil {
+							return fmt.Errorf("annotation delete err: %s: %w", nameWithOwner, err)
+						}
+						n, err := res.RowsAffected()
+						if err != nil {
+							return fmt.Errorf("rows affected err: %w", err)
+						}
+						deleted += int(n)
+						continue
+					}
+					res, err := tx.ExecContext(
+						timeCtx,
+						`
+						INSERT INTO RepoAnnotation (
+							Repo_id,
+							Name,
+							Value,
+							UpdatedAt
+						)
+						VALUES (?, ?, ?, ?)
+						ON CONFLICT(Repo_id, Name)
+						DO UPDATE SET
+							Value = excluded.Value,
+							UpdatedAt = excluded.UpdatedAt
+						WHERE Value != excluded.Value
+						`,
+						repoID,
+						name,
+						value,
+						(*NullTime)(&now),
+					)
+					if err != nil {
+						return fmt.Errorf("annotation insert err: %s: %w", nameWithOwner, err)
+					}
+					// unchanged annotations aren't updated, so don't count them
+					n, err := res.RowsAffected()
+					if err != nil {
+						return fmt.Errorf("rows affected err: %w", err)
+					}
+					upserted += int(n)
+				}
+			}
+			return nil
+		},
+	)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf(
+		"Annotations saved: %d, deleted: %d, rows for repos not in %s: %d\n",
+		upserted,
+		deleted,
+		dsn,
+		unknownRepos,
+	)
+	return nil
+}
@@ -0,0 +1,265 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"google.golang.org/api/sheets/v4"
+)
+
+// removedAtColumn is the column sync manages to flag stars that are no longer
+// in the download. It holds the date sync first noticed the star was gone.
+const removedAtColumn = "RemovedAt"
+
+// quoteSheetTitle quotes a sheet title for A1 notation
+// https://developers.google.com/sheets/api/guides/concepts#expandable-1
+func quoteSheetTitle(title string) string {
+	return "'" + strings.ReplaceAll(title, "'", "''") + "'"
+}
+
+// cellText returns the formatted text of a cell read with values.get
+func cellText(row []interface{}, col int) string {
+	if col >= len(row) {
+		return ""
+	}
+	str, _ := row[col].(string)
+	return str
+}
+
+// rowRun is a run of consecutive sheet rows
+type rowRun struct {
+	start int
+	rows  []*sheets.RowData
+}
+
+// gSheetsSync updates the CSV columns of an existing sheet in place, keyed on
+// NameWithOwner. New stars are appended, stars missing from the download get
+// a RemovedAt date, and any other columns are left alone.
+func gSheetsSync(ctx context.Context, srv *sheets.Service, spreadsheetId string, sheetProps *sheets.SheetProperties, downloadRows []*sheets.RowData) error {
+	sheetID := sheetProps.SheetId
+
+	existing, err := srv.Spreadsheets.Values.Get(
+		spreadsheetId,
+		quoteSheetTitle(sheetProps.Title),
+	).ValueRenderOption("FORMATTED_VALUE").Context(ctx).Do()
+	if err != nil {
+		return fmt.Errorf("can't read sheet: %w", err)
+	}
+
+	// Find where each column lives in the sheet. Missing columns go after the
+	// last header so they don't overwrite anything
+	var header []interface{}
+	if len(existing.Values) > 0 {
+		header = existing.Values[0]
+	}
+	sheetCol := make(map[string]int)
+	for i := range header {
+		name := cellText(header, i)
+		if name != "" {
+			if _, exists := sheetCol[name]; !exists {
+				sheetCol[name] = i
+			}
+		}
+	}
+	if len(existing.Values) > 1 {
+		if _, exists := sheetCol["NameWithOwner"]; !exists {
+			return fmt.Errorf("can't sync: sheet %s has data but no NameWithOwner header", sheetProps.Title)
+		}
+	}
+	nextCol := len(header)
+	var newHeaders []string
+	managedColumns := make([]string, 0, len(csvColumns)+1)
+	for i := range csvColumns {
+		managedColumns = append(managedColumns, csvColumns[i].Name)
+	}
+	managedColumns = append(managedColumns, removedAtColumn)
+	for _, name := range managedColumns {
+		if _, exists := sheetCol[name]; !exists {
+			sheetCol[name] = nextCol
+			nextCol++
+			newHeaders = append(newHeaders, name)
+		}
+	}
+
+	// downloadRows[0] is the header
+	nameCol := csvColumnIndex("NameWithOwner")
+	downloadByName := make(map[string]*sheets.RowData)
+	var downloadOrder []string
+	for _, row := range downloadRows[1:] {
+		name := *row.Values[nameCol].UserEnteredValue.StringValue
+		if _, exists := downloadByName[name]; !exists {
+			downloadOrder = append(downloadOrder, name)
+		}
+		downloadByName[name] = row
+	}
+
+	// Plan row updates. sheetRows[i] is the download row for sheet row i+1,
+	// or nil if the star was removed
+	existingNames := make(map[string]bool)
+	var sheetRows []*sheets.RowData
+	var removedRows []int
+	var removedAlreadyFlagged int
+	for i := 1; i < len(existing.Values); i++ {
+		name := cellText(existing.Values[i], sheetCol["NameWithOwner"])
+		existingNames[name] = true
+		row, exists := downloadByName[name]
+		if name == "" || !exists {
+			sheetRows = append(sheetRows, nil)
+			if name == "" {
+				continue
+			}
+			if cellText(existing.Values[i], sheetCol[removedAtColumn]) == "" {
+				removedRows = append(removedRows, i)
+			} else {
+				removedAlreadyFlagged++
+			}
+			continue
+		}
+		sheetRows = append(sheetRows, row)
+	}
+	updated := 0
+	for _, row := range sheetRows {
+		if row != nil {
+			updated++
+		}
+	}
+	appended := 0
+	for _, name := range downloadOrder {
+		if !existingNames[name] {
+			sheetRows = append(sheetRows, downloadByName[name])
+			appended++
+		}
+	}
+
+	// group consecutive present rows so each column is a few UpdateCells
+	var runs []rowRun
+	for i, row := range sheetRows {
+		if row == nil {
+			continue
+		}
+		sheetRow := i + 1
+		if len(runs) == 0 || runs[len(runs)-1].start+len(runs[len(runs)-1].rows) != sheetRow {
+			runs = append(runs, rowRun{start: sheetRow})
+		}
+		runs[len(runs)-1].rows = append(runs[len(runs)-1].rows, row)
+	}
+
+	var requests []*sheets.Request
+
+	// grow the grid if needed
+	neededRows := int64(len(sheetRows) + 1)
+	neededCols := int64(nextCol)
+	gridProps := &sheets.GridProperties{}
+	gridFields := []string{}
+	if neededRows > sheetProps.GridProperties.RowCount {
+		gridProps.RowCount = neededRows
+		gridFields = append(gridFields, "gridProperties.rowCount")
+	}
+	if neededCols > sheetProps.GridProperties.ColumnCount {
+		gridProps.ColumnCount = neededCols
+		gridFields = append(gridFields, "gridProperties.columnCount")
+	}
+	if len(gridFields) > 0 {
+		requests = append(requests, &sheets.Request{
+			UpdateSheetProperties: &sheets.UpdateSheetPropertiesRequest{
+				Fields: strings.Join(gridFields, ","),
+				Properties: &sheets.SheetProperties{
+					SheetId:        sheetID,
+					GridProperties: gridProps,
+				},
+			},
+		})
+	}
+
+	for _, name := range newHeaders {
+		requests = append(requests, &sheets.Request{
+			UpdateCells: &sheets.UpdateCellsRequest{
+				Fields: "userEnteredValue",
+				Rows: []*sheets.RowData{
+					{Values: []*sheets.CellData{sheetsStringCell(name)}},
+				},
+				Start: &sheets.GridCoordinate{
+					SheetId:     sheetID,
+					RowIndex:    0,
+					ColumnIndex: int64(sheetCol[name]),
+				},
+			},
+		})
+	}
+
+	for i := range csvColumns {
+		for _, run := range runs {
+			colRows := make([]*sheets.RowData, len(run.rows))
+			for j, row := range run.rows {
+				colRows[j] = &sheets.RowData{Values: []*sheets.CellData{row.Values[i]}}
+			}
+			requests = append(requests, &sheets.Request{
+				UpdateCells: &sheets.UpdateCellsRequest{
+					Fields: "userEnteredValue,userEnteredFormat",
+					Rows:   colRows,
+					Start: &sheets.GridCoordinate{
+						SheetId:     sheetID,
+						RowIndex:    int64(run.start),
+						ColumnIndex: int64(sheetCol[csvColumns[i].Name]),
+					},
+				},
+			})
+		}
+	}
+
+	// clear RemovedAt for stars that are back, flag newly removed ones
+	for _, run := range runs {
+		requests = append(requests, &sheets.Request{
+			RepeatCell: &sheets.RepeatCellRequest{
+				Range: &sheets.GridRange{
+					SheetId:          sheetID,
+					StartRowIndex:    int64(run.start),
+					EndRowIndex:      int64(run.start + len(run.rows)),
+					StartColumnIndex: int64(sheetCol[removedAtColumn]),
+					EndColumnIndex:   int64(sheetCol[removedAtColumn] + 1),
+				},
+				Cell:   &sheets.CellData{},
+				Fields: "userEnteredValue",
+			},
+		})
+	}
+	today := time.Now().Format("2006-01-02")
+	for _, sheetRow := range removedRows {
+		requests = append(requests, &sheets.Request{
+			UpdateCells: &sheets.UpdateCellsRequest{
+				Fields: "userEnteredValue",
+				Rows: []*sheets.RowData{
+					{Values: []*sheets.CellData{sheetsStringCell(today)}},
+				},
+				Start: &sheets.GridCoordinate{
+					SheetId:     sheetID,
+					RowIndex:    int64(sheetRow),
+					ColumnIndex: int64(sheetCol[removedAtColumn]),
+				},
+			},
+		})
+	}
+
+	if len(requests) > 0 {
+		_, err = srv.Spreadsheets.BatchUpdate(
+			spreadsheetId,
+			&sheets.BatchUpdateSpreadsheetRequest{
+				Requests: requests,
+			},
+		).Context(ctx).Do()
+		if err != nil {
+			return fmt.Errorf("batch error failure: %w", err)
+		}
+	}
+
+	fmt.Printf(
+		"Updated: %d, Appended: %d, Newly removed: %d, Previously removed: %d\n",
+		updated,
+		appended,
+		len(removedRows),
+		removedAlreadyFlagged,
+	)
+	return nil
+}
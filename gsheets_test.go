@@ -0,0 +1,47 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSheetsDatePattern(t *testing.T) {
+	tests := []struct {
+		dateFormat string
+		want       string
+		wantErr    string
+	}{
+		{dateFormat: "%b %d, %Y", want: `mmm" "dd", "yyyy`},
+		{dateFormat: "%F", want: `yyyy"-"mm"-"dd`},
+		{dateFormat: "%F %T", want: `yyyy"-"mm"-"dd" "hh":"mm":"ss`},
+		{dateFormat: "%m/%d %H:%M", want: `mm"/"dd" "hh":"mm`},
+		{dateFormat: "%M:%S", want: `mm":"ss`},
+		{dateFormat: "%I:%M %p", want: `h":"mm" "AM/PM`},
+		{dateFormat: `%Y "week" 100%%`, want: `yyyy" "\""week"\"" 100%"`},
+		{dateFormat: "%Y年%m月", want: `yyyy"年"mm"月"`},
+
+		{dateFormat: "%m/%Y %M", wantErr: "minutes can only be shown after an hour or before seconds"},
+		{dateFormat: "%H %m", wantErr: "a month after an hour or before seconds is shown as minutes"},
+		{dateFormat: "%m%S", wantErr: "a month after an hour or before seconds is shown as minutes"},
+		{dateFormat: "%T %M", wantErr: "minutes can only be shown after an hour or before seconds"},
+		{dateFormat: "%j", wantErr: "not supported by Google Sheets: %j"},
+		{dateFormat: "%Y%", wantErr: "trailing %"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.dateFormat, func(t *testing.T) {
+			got, err := sheetsDatePattern(tt.dateFormat)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("want error containing %q, got %q, %v", tt.wantErr, got, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Fatalf("want %s, got %s", tt.want, got)
+			}
+		})
+	}
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"fmt"
 	"os"
 
 	"go.bbkane.com/warg"
@@ -15,11 +16,19 @@ func app() *warg.App {
 	downloadCmd := command.New(
 		"Download star info",
 		githubStarsDownload,
+		command.Flag(
+			"--include-lists",
+			"Download which of your GitHub Lists each star is in",
+			value.Bool,
+			flag.Default("false"),
+			flag.EnvVars("STARGHAZE_INCLUDE_LISTS"),
+		),
 		command.Flag(
 			"--include-readmes",
 			"Search for README.md.",
 			value.Bool,
 			flag.Default("false"),
+			flag.EnvVars("STARGHAZE_INCLUDE_READMES"),
 		),
 		command.Flag(
 			"--max-languages",
@@ -47,7 +56,7 @@ func app() *warg.App {
 		),
 		command.Flag(
 			"--output",
-			"Output filepath. Must not exist",
+			"Output filepath. Must not exist. Compressed if it ends in .gz or .zst",
 			value.Path,
 			flag.Default("starghaze_download.jsonl"),
 		),
@@ -74,156 +83,1045 @@ func app() *warg.App {
 		),
 	)
 
+	diffCmd := command.New(
+		"Report what changed between two snapshots of stars",
+		diff,
+		command.Flag(
+			"--format",
+			"Output format",
+			value.StringEnum("text", "json"),
+			flag.Default("text"),
+			flag.Required(),
+		),
+		command.Flag(
+			"--min-star-change",
+			"Only report star count changes at least this big",
+			value.Int,
+			flag.Default("100"),
+			flag.Required(),
+		),
+		command.Flag(
+			"--new",
+			"Newer download file or SQLite database. Download files can be compressed, or - for stdin",
+			value.Path,
+			flag.Required(),
+		),
+		command.Flag(
+			"--old",
+			"Older download file or SQLite database. Download files can be compressed, or - for stdin",
+			value.Path,
+			flag.Required(),
+		),
+	)
+
+	mergeCmd := command.New(
+		"Merge download files into one, keeping the newest data for each repo",
+		merge,
+		command.Flag(
+			"--input",
+			"Download file to merge. Pass once per file. Later files win ties",
+			value.StringSlice,
+			flag.Required(),
+		),
+		command.Flag(
+			"--output",
+			"Output filepath. Must not exist. Compressed if it ends in .gz or .zst",
+			value.Path,
+			flag.Required(),
+		),
+		command.Flag(
+			"--page-size",
+			"Number of starred repos per line of output",
+			value.Int,
+			flag.Default("100"),
+			flag.Required(),
+		),
+	)
+
 	formatCmd := command.New(
 		"Format downloaded GitHub Stars",
 		format,
 		command.Flag(
 			"--format",
-			"Output format",
-			value.StringEnum("csv", "jsonl", "sqlite", "zinc"),
-			flag.Default("csv"),
-			flag.Required(),
+			"Output format: csv, jsonl, sqlite, template or zinc. Defaults to csv. Repeat to write several formats in one pass. Add a path with FORMAT:PATH (a DSN for sqlite), otherwise the format writes to --output",
+			value.StringSlice,
 		),
 		command.Flag(
 			"--date-format",
-			"Datetime output format. See https://github.com/lestrrat-go/strftime for details. If not passed, the GitHub default is RFC 3339. Consider using '%b %d, %Y' for csv format",
+			"Datetime output format. See https://github.com/lestrrat-go/strftime for details, or pass relative for dates like '3 months ago'. If not passed, the GitHub default is RFC 3339. Consider using '%b %d, %Y' for csv format",
+			value.String,
+		),
+		command.Flag(
+			"--pushed-at-format",
+			"PushedAt output format. Overrides --date-format",
+			value.String,
+		),
+		command.Flag(
+			"--starred-at-format",
+			"StarredAt output format. Overrides --date-format",
+			value.String,
+		),
+		command.Flag(
+			"--updated-at-format",
+			"UpdatedAt output format. Overrides --date-format",
 			value.String,
 		),
+		command.Flag(
+			"--timezone",
+			"Convert dates to this IANA timezone (like America/Los_Angeles or Local) before formatting. Defaults to GitHub's UTC",
+			value.String,
+			flag.EnvVars("STARGHAZE_TIMEZONE"),
+		),
 		command.Flag(
 			"--include-readmes",
 			"Search for README.md.",
 			value.Bool,
 			flag.Default("false"),
+			flag.EnvVars("STARGHAZE_INCLUDE_READMES"),
 			flag.Required(),
 		),
 		command.Flag(
 			"--sqlite-dsn",
-			"Sqlite DSN. Usually the file name. Only used for --format sqlite",
+			"Sqlite DSN. Usually the file name. Only used for --format sqlite without a DSN",
 			value.String,
 			flag.Default("starghaze.db"),
+			flag.EnvVars("STARGHAZE_SQLITE_DSN"),
+		),
+		command.Flag(
+			"--fts-tokenizer",
+			"Full text search tokenizer. porter stems words, trigram allows substring matches. Rebuilds the index if it changed. Only used for --format sqlite",
+			value.StringEnum("unicode61", "porter", "trigram"),
 		),
 		command.Flag(
 			"--zinc-index-name",
 			"Only used for --format zinc.",
 			value.String,
 			flag.Default("starghaze"),
+			flag.EnvVars("STARGHAZE_ZINC_INDEX_NAME"),
 		),
 		command.Flag(
 			"--input",
-			"Input file",
+			"Input file. Pass - for stdin. gzip and zstd input is decompressed",
 			value.String,
 			flag.Required(),
 			flag.Default("starghaze_download.jsonl"),
 		),
 		command.Flag(
-			"--max-line-size",
-			"Max line size in the file in MB",
+			"--output",
+			"Output file for formats passed without a path. Prints to stdout if not passed",
+			value.Path,
+		),
+		command.Flag(
+			"--exclude-archived",
+			"Skip archived repos",
+			value.Bool,
+			flag.Default("false"),
+			flag.Required(),
+		),
+		command.Flag(
+			"--exclude-forks",
+			"Skip forked repos",
+			value.Bool,
+			flag.Default("false"),
+			flag.Required(),
+		),
+		command.Flag(
+			"--language",
+			"Only format repos with this language. Repeat to allow any of several",
+			value.StringSlice,
+		),
+		command.Flag(
+			"--min-stars",
+			"Only format repos with at least this many stargazers",
 			value.Int,
-			flag.Default("10"),
+		),
+		command.Flag(
+			"--name-regex",
+			"Only format repos whose owner/name matches this regex. See https://pkg.go.dev/regexp/syntax",
+			value.String,
+		),
+		command.Flag(
+			"--starred-after",
+			"Only format repos starred after this date (2006-01-02 or RFC 3339)",
+			value.String,
+		),
+		command.Flag(
+			"--starred-before",
+			"Only format repos starred before this date (2006-01-02 or RFC 3339)",
+			value.String,
+		),
+		command.Flag(
+			"--topic",
+			"Only format repos with this topic. Repeat to allow any of several",
+			value.StringSlice,
+		),
+		command.Flag(
+			"--where",
+			`Only format repos matching this expression. Example: 'stars > 1000 && "go" in languages'. See the README for fields and operators`,
+			value.String,
+		),
+		command.Flag(
+			"--columns",
+			fmt.Sprintf(
+				"CSV columns to print, in order. Repeat or comma separate them. Defaults to %s. Also available: %s",
+				csvColumnNames(csvColumns),
+				csvColumnNames(csvExtraColumns),
+			),
+			value.StringSlice,
+		),
+		command.Flag(
+			"--delimiter",
+			"CSV field delimiter. Pass tab for TSV",
+			value.String,
+			flag.Default(","),
 			flag.Required(),
 		),
 		command.Flag(
-			"--output",
-			"output file. Prints to stdout if not passed",
+			"--list-separator",
+			"Separator for CSV list columns (Languages, Lists, Topics)",
+			value.String,
+			flag.Default(" "),
+			flag.Required(),
+		),
+		command.Flag(
+			"--template-file",
+			"text/template file run for each star with --format template. Define \"header\" and \"footer\" templates in it to print text before and after the stars. See the README for helper functions",
 			value.Path,
 		),
+		command.Flag(
+			"--readme-max-chars",
+			"Truncate the CSV README column to this many characters. 0 means no limit",
+			value.Int,
+			flag.Default("0"),
+			flag.Required(),
+		),
 	)
 
-	gsheetsSection := section.New(
-		"Google Sheets commands",
-		section.Command(
-			"open",
-			"Open spreadsheet in browser",
-			gSheetsOpen,
+	syncCmd := command.New(
+		"Download stars and write them to every --sink at once",
+		syncStars,
+		command.Flag(
+			"--sink",
+			"Where to write stars: sqlite[:DSN], csv:PATH, jsonl:PATH (a raw download archive, PATH may use strftime verbs and is compressed if it ends in .gz or .zst), zinc[:PATH] (bulk uploads to --zinc-url if passed) or gsheets. Pass once per sink or comma separate them",
+			value.StringSlice,
+			flag.EnvVars("STARGHAZE_SINKS"),
+			flag.Required(),
 		),
-		section.Command(
-			"upload",
-			"Upload CSV to Google Sheets. This will overwrite whatever is in the spreadsheet",
-			gSheetsUpload,
-			command.Flag(
-				"--csv-path",
-				"CSV file to upload",
-				value.Path,
-				flag.Required(),
-			),
-			command.Flag(
-				"--timeout",
-				"Timeout for a run. Use https://pkg.go.dev/time#Duration to build it",
-				value.Duration,
-				flag.Default("10m"),
-				flag.Required(),
-			),
+		command.Flag(
+			"--after-cursor",
+			"PageInfo EndCursor to start from",
+			value.String,
 		),
-		section.Flag(
+		command.Flag(
+			"--credentials-file",
+			"Service account or authorized user credentials JSON for the gsheets sink. Overrides the login token and default credentials",
+			value.Path,
+			flag.EnvVars("STARGHAZE_GOOGLE_CREDENTIALS_FILE"),
+		),
+		command.Flag(
+			"--date-format",
+			"Datetime output format. See https://github.com/lestrrat-go/strftime for details, or pass relative for dates like '3 months ago'. If not passed, the GitHub default is RFC 3339. The gsheets sink only supports verbs with a Google Sheets equivalent",
+			value.String,
+		),
+		command.Flag(
+			"--pushed-at-format",
+			"PushedAt output format. Overrides --date-format",
+			value.String,
+		),
+		command.Flag(
+			"--starred-at-format",
+			"StarredAt output format. Overrides --date-format",
+			value.String,
+		),
+		command.Flag(
+			"--updated-at-format",
+			"UpdatedAt output format. Overrides --date-format",
+			value.String,
+		),
+		command.Flag(
+			"--timezone",
+			"Convert dates to this IANA timezone (like America/Los_Angeles or Local) before formatting. Defaults to GitHub's UTC",
+			value.String,
+			flag.EnvVars("STARGHAZE_TIMEZONE"),
+		),
+		command.Flag(
+			"--gsheets-sync",
+			"Update gsheets sink rows in place by NameWithOwner instead of overwriting the sheet",
+			value.Bool,
+			flag.Default("false"),
+			flag.Required(),
+		),
+		command.Flag(
+			"--include-lists",
+			"Download which of your GitHub Lists each star is in",
+			value.Bool,
+			flag.Default("false"),
+			flag.EnvVars("STARGHAZE_INCLUDE_LISTS"),
+		),
+		command.Flag(
+			"--include-readmes",
+			"Search for README.md.",
+			value.Bool,
+			flag.Default("false"),
+			flag.EnvVars("STARGHAZE_INCLUDE_READMES"),
+		),
+		command.Flag(
+			"--max-languages",
+			"Max number of languages to query on a repo",
+			value.Int,
+			flag.Default("20"),
+		),
+		command.Flag(
+			"--max-pages",
+			"Max number of pages to fetch",
+			value.Int,
+			flag.Default("1"),
+			flag.Required(),
+		),
+		command.Flag(
+			"--max-repo-topics",
+			"Max number of topics to query on a repo",
+			value.Int,
+			flag.Default("20"),
+		),
+		command.Flag(
+			"--page-size",
+			"Number of starred repos in page",
+			value.Int,
+			flag.Default("100"),
+			flag.Required(),
+		),
+		command.Flag(
 			"--sheet-id",
-			"ID For the particulare sheet. Viewable from `gid` URL param",
+			"Sheet for the gsheets sink. Viewable from `gid` URL param",
 			value.Int,
 			flag.EnvVars("STARGHAZE_SHEET_ID"),
-			flag.Required(),
 		),
-		section.Flag(
+		command.Flag(
+			"--sheet-name",
+			"Sheet (tab) for the gsheets sink, created if needed. Overrides --sheet-id",
+			value.String,
+			flag.EnvVars("STARGHAZE_SHEET_NAME"),
+		),
+		command.Flag(
 			"--spreadsheet-id",
-			"ID for the whole spreadsheet. Viewable from URL",
+			"Spreadsheet for the gsheets sink. Viewable from URL",
 			value.String,
 			flag.EnvVars("STARGHAZE_SPREADSHEET_ID"),
+		),
+		command.Flag(
+			"--sqlite-dsn",
+			"Sqlite DSN for the sqlite sink. Usually the file name.",
+			value.String,
+			flag.Default("starghaze.db"),
+			flag.EnvVars("STARGHAZE_SQLITE_DSN"),
 			flag.Required(),
 		),
-	)
-
-	searchCmd := command.New(
-
-		"Full text search SQLite database",
-		search,
 		command.Flag(
-			"--limit",
-			"Max number of results",
-			value.Int,
-			flag.Default("50"),
+			"--timeout",
+			"Timeout for a run. Use https://pkg.go.dev/time#Duration to build it",
+			value.Duration,
+			flag.Default("10m"),
 			flag.Required(),
 		),
 		command.Flag(
-			"--sqlite-dsn",
-			"Sqlite DSN. Usually the file name.",
+			"--token",
+			"Github PAT",
 			value.String,
-			flag.Default("starghaze.db"),
+			flag.EnvVars("STARGHAZE_GITHUB_TOKEN", "GITHUB_TOKEN"),
 			flag.Required(),
 		),
 		command.Flag(
-			"--term",
-			"Search for this term",
+			"--zinc-index-name",
+			"Index name for the zinc sink",
 			value.String,
-			flag.Alias("-t"),
+			flag.Default("starghaze"),
+			flag.EnvVars("STARGHAZE_ZINC_INDEX_NAME"),
 			flag.Required(),
 		),
-
-		// TODO: how many results? limit by date added?
+		command.Flag(
+			"--zinc-password",
+			"Zinc password for --zinc-url",
+			value.String,
+			flag.EnvVars("STARGHAZE_ZINC_PASSWORD"),
+		),
+		command.Flag(
+			"--zinc-url",
+			"Zinc server to bulk upload the zinc sink to. Example: http://localhost:4080",
+			value.String,
+			flag.EnvVars("STARGHAZE_ZINC_URL"),
+		),
+		command.Flag(
+			"--zinc-user",
+			"Zinc user for --zinc-url",
+			value.String,
+			flag.EnvVars("STARGHAZE_ZINC_USER"),
+		),
 	)
 
-	app := warg.New(
-		"starghaze",
-		section.New(
-			"Save GitHub Starred Repos",
-			section.Command(
-				"version",
-				"Print version",
-				printVersion,
+	gsheetsSection := section.New(
+		"Google Sheets commands",
+		section.Command(
+			"login",
+			"Log in to Google in the browser and save the token for other gsheets commands",
+			gSheetsLogin,
+			command.Flag(
+				"--client-secret-file",
+				"Client secret JSON for a Desktop app OAuth client. Download it from the Google Cloud console",
+				value.Path,
+				flag.EnvVars("STARGHAZE_GOOGLE_CLIENT_SECRET_FILE"),
+				flag.Required(),
 			),
-			section.ExistingCommand(
+			command.Flag(
+				"--timeout",
+				"Time to wait for the login to finish. Use https://pkg.go.dev/time#Duration to build it",
+				value.Duration,
+				flag.Default("5m"),
+				flag.Required(),
+			),
+		),
+		section.Command(
+			"logout",
+			"Delete the token saved by login",
+			gSheetsLogout,
+		),
+		section.Command(
+			"open",
+			"Open spreadsheet in browser",
+			gSheetsOpen,
+		),
+		section.Command(
+			"download",
+			"Merge annotation columns (notes, tags, ...) from a sheet into the SQLite database, matched by NameWithOwner",
+			gSheetsDownload,
+			command.Flag(
+				"--column",
+				"Sheet column to save as an annotation. Pass once per column",
+				value.StringSlice,
+				flag.Required(),
+			),
+			command.Flag(
+				"--key-column",
+				"Sheet column holding owner/name",
+				value.String,
+				flag.Default("NameWithOwner"),
+				flag.Required(),
+			),
+			command.Flag(
+				"--range",
+				"Named range or A1 range to read, including the header row. Overrides --sheet-name and --sheet-id",
+				value.String,
+			),
+			command.Flag(
+				"--sheet-name",
+				"Read the sheet (tab) with this name. Overrides --sheet-id",
+				value.String,
+				flag.EnvVars("STARGHAZE_SHEET_NAME"),
+			),
+			command.Flag(
+				"--sqlite-dsn",
+				"Sqlite DSN. Usually the file name.",
+				value.String,
+				flag.Default("starghaze.db"),
+				flag.EnvVars("STARGHAZE_SQLITE_DSN"),
+				flag.Required(),
+			),
+			command.Flag(
+				"--timeout",
+				"Timeout for a run. Use https://pkg.go.dev/time#Duration to build it",
+				value.Duration,
+				flag.Default("10m"),
+				flag.Required(),
+			),
+		),
+		section.Command(
+			"upload",
+			"Upload stars to Google Sheets. This will overwrite whatever is in the spreadsheet",
+			gSheetsUpload,
+			command.Flag(
+				"--auto-filter",
+				"Add a filter to the header row",
+				value.Bool,
+				flag.Default("false"),
+				flag.Required(),
+			),
+			command.Flag(
+				"--csv-path",
+				"CSV file to upload. Pass this or --input",
+				value.Path,
+			),
+			command.Flag(
+				"--format-columns",
+				"Bold the header, clip long cells and fit column widths to the data",
+				value.Bool,
+				flag.Default("false"),
+				flag.Required(),
+			),
+			command.Flag(
+				"--freeze-header",
+				"Freeze the header row",
+				value.Bool,
+				flag.Default("false"),
+				flag.Required(),
+			),
+			command.Flag(
+				"--dashboard-sheet-name",
+				"Sheet (tab) for --with-dashboard. It's overwritten on every upload",
+				value.String,
+				flag.Default("Dashboard"),
+				flag.Required(),
+			),
+			command.Flag(
+				"--dashboard-top",
+				"Number of languages and topics in the --with-dashboard charts",
+				value.Int,
+				flag.Default("10"),
+				flag.Required(),
+			),
+			command.Flag(
+				"--date-format",
+				"Datetime display format for --input. See https://github.com/lestrrat-go/strftime for details. Only verbs with a Google Sheets equivalent are supported",
+				value.String,
+			),
+			command.Flag(
+				"--pushed-at-format",
+				"PushedAt display format for --input. Overrides --date-format",
+				value.String,
+			),
+			command.Flag(
+				"--starred-at-format",
+				"StarredAt display format for --input. Overrides --date-format",
+				value.String,
+			),
+			command.Flag(
+				"--timezone",
+				"Show --input dates in this IANA timezone (like America/Los_Angeles or Local). Defaults to GitHub's UTC",
+				value.String,
+				flag.EnvVars("STARGHAZE_TIMEZONE"),
+			),
+			command.Flag(
+				"--updated-at-format",
+				"UpdatedAt display format for --input. Overrides --date-format",
+				value.String,
+			),
+			command.Flag(
+				"--include-readmes",
+				"Upload READMEs from --input. Long READMEs are truncated to fit in a cell",
+				value.Bool,
+				flag.Default("false"),
+				flag.EnvVars("STARGHAZE_INCLUDE_READMES"),
+				flag.Required(),
+			),
+			command.Flag(
+				"--input",
+				"Downloaded stars to upload as typed cells. Pass this or --csv-path. Pass - for stdin. gzip and zstd input is decompressed",
+				value.Path,
+			),
+			command.Flag(
+				"--resize",
+				"Resize the sheet to exactly fit the data. Without this, the sheet only grows",
+				value.Bool,
+				flag.Default("false"),
+				flag.Required(),
+			),
+			command.Flag(
+				"--sheet-name",
+				"Upload to the sheet (tab) with this name, creating it if needed. Overrides --sheet-id",
+				value.String,
+				flag.EnvVars("STARGHAZE_SHEET_NAME"),
+			),
+			command.Flag(
+				"--sync",
+				"Update rows in place by NameWithOwner instead of overwriting the sheet. Appends new stars, sets RemovedAt on unstarred ones, and leaves other columns alone. Needs --input",
+				value.Bool,
+				flag.Default("false"),
+				flag.Required(),
+			),
+			command.Flag(
+				"--timeout",
+				"Timeout for a run. Use https://pkg.go.dev/time#Duration to build it",
+				value.Duration,
+				flag.Default("10m"),
+				flag.Required(),
+			),
+			command.Flag(
+				"--with-dashboard",
+				"Create or refresh a dashboard sheet with charts and pivot tables of stars per month, top languages and top topics. Needs --input",
+				value.Bool,
+				flag.Default("false"),
+				flag.Required(),
+			),
+		),
+		section.Flag(
+			"--credentials-file",
+			"Service account or authorized user credentials JSON. Overrides the login token and default credentials",
+			value.Path,
+			flag.EnvVars("STARGHAZE_GOOGLE_CREDENTIALS_FILE"),
+		),
+		section.Flag(
+			"--sheet-id",
+			"ID For the particulare sheet. Viewable from `gid` URL param",
+			value.Int,
+			flag.EnvVars("STARGHAZE_SHEET_ID"),
+		),
+		section.Flag(
+			"--spreadsheet-id",
+			"ID for the whole spreadsheet. Viewable from URL",
+			value.String,
+			flag.EnvVars("STARGHAZE_SPREADSHEET_ID"),
+		),
+	)
+
+	chartSection := section.New(
+		"Chart stars from the SQLite database in the terminal or as SVG/HTML",
+		section.Command(
+			"languages",
+			"Chart the languages in the most starred repos",
+			chartAction(chartLanguagesData),
+			command.Flag(
+				"--limit",
+				"Number of languages to chart",
+				value.Int,
+				flag.Default("10"),
+				flag.Required(),
+			),
+		),
+		section.Command(
+			"per-month",
+			"Chart stars per month",
+			chartAction(chartPerMonthData),
+		),
+		section.Command(
+			"topics-over-time",
+			"Chart how often the most starred topics were starred over time",
+			chartAction(chartTopicsOverTimeData),
+			command.Flag(
+				"--limit",
+				"Number of topics to chart",
+				value.Int,
+				flag.Default("5"),
+				flag.Required(),
+			),
+			command.Flag(
+				"--period",
+				"Count stars per month or year",
+				value.StringEnum("month", "year"),
+				flag.Default("year"),
+				flag.Required(),
+			),
+		),
+		section.Flag(
+			"--output",
+			"Write the chart to an .svg or .html file instead of the terminal",
+			value.Path,
+		),
+		section.Flag(
+			"--sqlite-dsn",
+			"Sqlite DSN. Usually the file name.",
+			value.String,
+			flag.Default("starghaze.db"),
+			flag.EnvVars("STARGHAZE_SQLITE_DSN"),
+			flag.Required(),
+		),
+		section.Flag(
+			"--width",
+			"Width of the longest terminal bar in characters",
+			value.Int,
+			flag.Default("60"),
+			flag.Required(),
+		),
+	)
+
+	dbSection := section.New(
+		"SQLite database commands",
+		section.Command(
+			"reindex",
+			"Rebuild the full text search index with a new tokenizer",
+			dbReindex,
+			command.Flag(
+				"--fts-tokenizer",
+				"Full text search tokenizer. porter stems words, trigram allows substring matches",
+				value.StringEnum("unicode61", "porter", "trigram"),
+				flag.Default("unicode61"),
+				flag.Required(),
+			),
+		),
+		section.Flag(
+			"--sqlite-dsn",
+			"Sqlite DSN. Usually the file name.",
+			value.String,
+			flag.Default("starghaze.db"),
+			flag.EnvVars("STARGHAZE_SQLITE_DSN"),
+			flag.Required(),
+		),
+	)
+
+	embedCmd := command.New(
+		"Compute embeddings of repo descriptions and READMEs for semantic search",
+		embedRepos,
+		command.Flag(
+			"--batch-size",
+			"Number of repos to embed per request",
+			value.Int,
+			flag.Default("32"),
+			flag.Required(),
+		),
+		command.Flag(
+			"--embed-url",
+			"Base URL of an OpenAI-compatible embeddings API. Ollama and llama.cpp serve one locally",
+			value.String,
+			flag.Default("http://localhost:11434/v1"),
+			flag.EnvVars("STARGHAZE_EMBED_URL"),
+			flag.Required(),
+		),
+		command.Flag(
+			"--embed-model",
+			"Embedding model name",
+			value.String,
+			flag.Default("nomic-embed-text"),
+			flag.EnvVars("STARGHAZE_EMBED_MODEL"),
+			flag.Required(),
+		),
+		command.Flag(
+			"--embed-api-key",
+			"API key for the embeddings API. Usually not needed for local servers",
+			value.String,
+			flag.EnvVars("STARGHAZE_EMBED_API_KEY", "OPENAI_API_KEY"),
+		),
+		command.Flag(
+			"--max-input-chars",
+			"Truncate the text embedded for each repo to this many bytes. 0 means no limit",
+			value.Int,
+			flag.Default("8000"),
+			flag.Required(),
+		),
+		command.Flag(
+			"--sqlite-dsn",
+			"Sqlite DSN. Usually the file name.",
+			value.String,
+			flag.Default("starghaze.db"),
+			flag.EnvVars("STARGHAZE_SQLITE_DSN"),
+			flag.Required(),
+		),
+		command.Flag(
+			"--timeout",
+			"Timeout for a run. Use https://pkg.go.dev/time#Duration to build it",
+			value.Duration,
+			flag.Default("30m"),
+			flag.Required(),
+		),
+	)
+
+	searchCmd := command.New(
+		"Full text search SQLite database",
+		search,
+		command.Flag(
+			"--date-format",
+			"StarredAt output format. See https://github.com/lestrrat-go/strftime for details, or pass relative for dates like '3 months ago'. If not passed, dates are RFC 3339",
+			value.String,
+		),
+		command.Flag(
+			"--embed-url",
+			"Base URL of an OpenAI-compatible embeddings API. Ollama and llama.cpp serve one locally",
+			value.String,
+			flag.Default("http://localhost:11434/v1"),
+			flag.EnvVars("STARGHAZE_EMBED_URL"),
+			flag.Required(),
+		),
+		command.Flag(
+			"--embed-model",
+			"Embedding model name",
+			value.String,
+			flag.Default("nomic-embed-text"),
+			flag.EnvVars("STARGHAZE_EMBED_MODEL"),
+			flag.Required(),
+		),
+		command.Flag(
+			"--embed-api-key",
+			"API key for the embeddings API. Usually not needed for local servers",
+			value.String,
+			flag.EnvVars("STARGHAZE_EMBED_API_KEY", "OPENAI_API_KEY"),
+		),
+		command.Flag(
+			"--fts-weight",
+			"Percent (0-100) of a --semantic score that comes from full text search rank",
+			value.Int,
+			flag.Default("0"),
+			flag.Required(),
+		),
+		command.Flag(
+			"--language",
+			"Only show repos with this language",
+			value.String,
+		),
+		command.Flag(
+			"--limit",
+			"Max number of results, or negative for all",
+			value.Int,
+			flag.Default("50"),
+			flag.Required(),
+		),
+		command.Flag(
+			"--list",
+			"Only show repos in this GitHub List",
+			value.String,
+		),
+		command.Flag(
+			"--semantic",
+			"Rank by embedding similarity instead of full text search. Run `starghaze embed` first",
+			value.Bool,
+			flag.Default("false"),
+			flag.Required(),
+		),
+		command.Flag(
+			"--term",
+			"Search for this term",
+			value.String,
+			flag.Alias("-t"),
+			flag.Required(),
+		),
+		command.Flag(
+			"--topic",
+			"Only show repos with this topic",
+			value.String,
+		),
+		command.Flag(
+			"--timeout",
+			"Timeout for a --semantic search. Use https://pkg.go.dev/time#Duration to build it",
+			value.Duration,
+			flag.Default("1m"),
+			flag.Required(),
+		),
+		command.Flag(
+			"--sqlite-dsn",
+			"Sqlite DSN. Usually the file name.",
+			value.String,
+			flag.Default("starghaze.db"),
+			flag.EnvVars("STARGHAZE_SQLITE_DSN"),
+			flag.Required(),
+		),
+		command.Flag(
+			"--timezone",
+			"Convert dates to this IANA timezone (like America/Los_Angeles or Local) before formatting. Defaults to UTC",
+			value.String,
+			flag.EnvVars("STARGHAZE_TIMEZONE"),
+		),
+
+		// TODO: how many results? limit by date added?
+	)
+
+	savedSearchSection := section.New(
+		"Save searches and report repos that newly match them",
+		section.Command(
+			"save",
+			"Save a named search. Its current matches won't be reported by new-matches",
+			searchSave,
+			command.Flag(
+				"--language",
+				"Only match repos with this language",
+				value.String,
+			),
+			command.Flag(
+				"--list",
+				"Only match repos in this GitHub List",
+				value.String,
+			),
+			command.Flag(
+				"--name",
+				"Saved search name",
+				value.String,
+				flag.Required(),
+			),
+			command.Flag(
+				"--term",
+				"Search for this term",
+				value.String,
+				flag.Alias("-t"),
+				flag.Required(),
+			),
+			command.Flag(
+				"--topic",
+				"Only match repos with this topic",
+				value.String,
+			),
+		),
+		section.Command(
+			"list",
+			"List saved searches",
+			searchList,
+		),
+		section.Command(
+			"run",
+			"Run a saved search",
+			searchRun,
+			command.Flag(
+				"--limit",
+				"Max number of results",
+				value.Int,
+				flag.Default("50"),
+				flag.Required(),
+			),
+			command.Flag(
+				"--name",
+				"Saved search name",
+				value.String,
+				flag.Required(),
+			),
+		),
+		section.Command(
+			"delete",
+			"Delete a saved search",
+			searchDelete,
+			command.Flag(
+				"--name",
+				"Saved search name",
+				value.String,
+				flag.Required(),
+			),
+		),
+		section.Command(
+			"new-matches",
+			"List repos that newly match saved searches since the last new-matches. Run after each import",
+			searchNewMatches,
+		),
+		section.Flag(
+			"--date-format",
+			"StarredAt output format. See https://github.com/lestrrat-go/strftime for details, or pass relative for dates like '3 months ago'. If not passed, dates are RFC 3339",
+			value.String,
+		),
+		section.Flag(
+			"--sqlite-dsn",
+			"Sqlite DSN. Usually the file name.",
+			value.String,
+			flag.Default("starghaze.db"),
+			flag.EnvVars("STARGHAZE_SQLITE_DSN"),
+			flag.Required(),
+		),
+		section.Flag(
+			"--timezone",
+			"Convert dates to this IANA timezone (like America/Los_Angeles or Local) before formatting. Defaults to UTC",
+			value.String,
+			flag.EnvVars("STARGHAZE_TIMEZONE"),
+		),
+	)
+
+	similarCmd := command.New(
+		"List starred repos similar to a starred repo",
+		similar,
+		command.Flag(
+			"--language-weight",
+			"Relative weight of language byte-distribution similarity",
+			value.Int,
+			flag.Default("1"),
+			flag.Required(),
+		),
+		command.Flag(
+			"--limit",
+			"Max number of results",
+			value.Int,
+			flag.Default("10"),
+			flag.Required(),
+		),
+		command.Flag(
+			"--repo",
+			"Starred repo to compare to, as owner/name",
+			value.String,
+			flag.Alias("-r"),
+			flag.Required(),
+		),
+		command.Flag(
+			"--sqlite-dsn",
+			"Sqlite DSN. Usually the file name.",
+			value.String,
+			flag.Default("starghaze.db"),
+			flag.EnvVars("STARGHAZE_SQLITE_DSN"),
+			flag.Required(),
+		),
+		command.Flag(
+			"--text-weight",
+			"Relative weight of TF-IDF similarity of descriptions and READMEs",
+			value.Int,
+			flag.Default("2"),
+			flag.Required(),
+		),
+		command.Flag(
+			"--topic-weight",
+			"Relative weight of topic overlap",
+			value.Int,
+			flag.Default("2"),
+			flag.Required(),
+		),
+	)
+
+	app := warg.New(
+		"starghaze",
+		section.New(
+			"Save GitHub Starred Repos",
+			section.Command(
+				"version",
+				"Print version",
+				printVersion,
+			),
+			section.ExistingSection(
+				"chart",
+				chartSection,
+			),
+			section.ExistingSection(
+				"db",
+				dbSection,
+			),
+			section.ExistingCommand(
+				"diff",
+				diffCmd,
+			),
+			section.ExistingCommand(
 				"download",
 				downloadCmd,
 			),
+			section.ExistingCommand(
+				"embed",
+				embedCmd,
+			),
 			section.ExistingCommand(
 				"format",
 				formatCmd,
 			),
+			section.ExistingCommand(
+				"merge",
+				mergeCmd,
+			),
 			section.ExistingCommand(
 				"search",
 				searchCmd,
 			),
+			section.ExistingCommand(
+				"similar",
+				similarCmd,
+			),
+			section.ExistingCommand(
+				"sync",
+				syncCmd,
+			),
 			section.ExistingSection(
 				"gsheets",
 				gsheetsSection,
 			),
+			section.ExistingSection(
+				"saved-search",
+				savedSearchSection,
+			),
+			section.Flag(
+				"--config",
+				"YAML config file of flag defaults. Defaults to starghaze/starghaze.yaml in the user config dir",
+				value.Path,
+				flag.EnvVars("STARGHAZE_CONFIG"),
+			),
+			section.Flag(
+				"--profile",
+				"Config file profile to use. Overrides default_profile in the config",
+				value.String,
+				flag.EnvVars("STARGHAZE_PROFILE"),
+			),
 			section.Footer("Homepage: https://github.com/bbkane/starghaze"),
 		),
 		warg.SkipValidation(),
@@ -232,5 +1130,10 @@ func app() *warg.App {
 }
 
 func main() {
-	app().MustRun(os.Args, os.LookupEnv)
+	lookup, err := configLookup(os.Args, os.LookupEnv)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	app().MustRun(os.Args, lookup)
 }
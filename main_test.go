@@ -1,6 +1,11 @@
 package main
 
 import (
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -9,3 +14,282 @@ func TestBuildApp(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+// testEdge builds a star with the fields merge and diff look at
+func testEdge(nameWithOwner string, starredAt string, updatedAt string, stars int) starredRepositoryEdge {
+	var edge starredRepositoryEdge
+	edge.StarredAt = formattedDate{datetime: starredAt}
+	edge.Node.NameWithOwner = nameWithOwner
+	edge.Node.UpdatedAt = formattedDate{datetime: updatedAt}
+	edge.Node.StargazerCount = stars
+	return edge
+}
+
+// writeTestDownload writes edges to a download file in dir fetched at
+// fetchedAt, and returns its path
+func writeTestDownload(t *testing.T, dir string, name string, fetchedAt string, edges ...starredRepositoryEdge) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	fp, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fp.Close()
+	header := downloadHeader{
+		Version:          downloadFormatVersion,
+		StarghazeVersion: "test",
+		FetchedAt:        fetchedAt,
+		Login:            "bbkane",
+		AfterCursor:      nil,
+		IncludeLists:     false,
+		IncludeReadmes:   true,
+		MaxLanguages:     20,
+		MaxRepoTopics:    20,
+		PageSize:         100,
+	}
+	var query Query
+	query.Viewer.Login = "bbkane"
+	query.Viewer.StarredRepositories.Edges = edges
+	if err := newDownloadWriter(fp, header).WritePage(&query); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestMergeDownloads(t *testing.T) {
+	dir := t.TempDir()
+	older := writeTestDownload(t, dir, "older.jsonl", "2022-01-01T00:00:00Z",
+		testEdge("a/db", "2020-01-01T00:00:00Z", "2021-01-01T00:00:00Z", 1),
+		testEdge("b/web", "2020-02-01T00:00:00Z", "2021-06-01T00:00:00Z", 2),
+		testEdge("c/cli", "2020-03-01T00:00:00Z", "2021-01-01T00:00:00Z", 3),
+	)
+	newer := writeTestDownload(t, dir, "newer.jsonl", "2022-02-01T00:00:00Z",
+		// newer UpdatedAt, and names match ignoring case
+		testEdge("A/DB", "2020-01-01T00:00:00Z", "2021-02-01T00:00:00Z", 10),
+		// older UpdatedAt loses, even from a newer download
+		testEdge("b/web", "2020-02-01T00:00:00Z", "2021-05-01T00:00:00Z", 20),
+		// same UpdatedAt goes to the newer download
+		testEdge("c/cli", "2020-03-01T00:00:00Z", "2021-01-01T00:00:00Z", 30),
+		testEdge("d/new", "2019-01-01T00:00:00Z", "2021-01-01T00:00:00Z", 40),
+	)
+
+	for _, inputs := range [][]string{{older, newer}, {newer, older}} {
+		edges, header, err := mergeDownloads(inputs)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, e := range edges {
+			got = append(got, fmt.Sprintf("%s %d", e.Node.NameWithOwner, e.Node.StargazerCount))
+		}
+		// sorted by StarredAt
+		want := "d/new 40,A/DB 10,b/web 2,c/cli 30"
+		if strings.Join(got, ",") != want {
+			t.Fatalf("inputs %v: want %s, got %s", inputs, want, strings.Join(got, ","))
+		}
+		if header.FetchedAt != "2022-02-01T00:00:00Z" || header.Login != "bbkane" || !header.IncludeReadmes || header.IncludeLists {
+			t.Fatalf("unexpected header: %+v", header)
+		}
+	}
+
+	// ties in both UpdatedAt and FetchedAt go to the later input
+	first := writeTestDownload(t, dir, "first.jsonl", "2022-01-01T00:00:00Z",
+		testEdge("a/db", "2020-01-01T00:00:00Z", "2021-01-01T00:00:00Z", 1),
+	)
+	second := writeTestDownload(t, dir, "second.jsonl", "2022-01-01T00:00:00Z",
+		testEdge("a/db", "2020-01-01T00:00:00Z", "2021-01-01T00:00:00Z", 2),
+	)
+	edges, _, err := mergeDownloads([]string{first, second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(edges) != 1 || edges[0].Node.StargazerCount != 2 {
+		t.Fatalf("want the later input's copy, got %+v", edges)
+	}
+
+	// files without a header didn't record READMEs
+	legacy := filepath.Join(dir, "legacy.jsonl")
+	err = os.WriteFile(legacy, []byte(`{"Viewer":{"StarredRepositories":{"Edges":[]}}}`+"\n"), 0666)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, header, err := mergeDownloads([]string{older, legacy})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if header.IncludeReadmes {
+		t.Fatalf("want IncludeReadmes false, got %+v", header)
+	}
+
+	// repos are matched by node ID, then by name for stars without one
+	withID := func(id string, edge starredRepositoryEdge) starredRepositoryEdge {
+		edge.Node.ID = id
+		return edge
+	}
+	noIDs := writeTestDownload(t, dir, "no-ids.jsonl", "2022-01-01T00:00:00Z",
+		testEdge("a/db", "2020-01-01T00:00:00Z", "2021-01-01T00:00:00Z", 1),
+		testEdge("b/web", "2020-02-01T00:00:00Z", "2021-01-01T00:00:00Z", 2),
+	)
+	ids := writeTestDownload(t, dir, "ids.jsonl", "2022-02-01T00:00:00Z",
+		withID("A", testEdge("A/DB", "2020-01-01T00:00:00Z", "2021-02-01T00:00:00Z", 10)),
+		withID("B", testEdge("b/web", "2020-02-01T00:00:00Z", "2021-02-01T00:00:00Z", 20)),
+	)
+	renamed := writeTestDownload(t, dir, "renamed.jsonl", "2022-03-01T00:00:00Z",
+		// b/web was renamed, and a new repo took its name
+		withID("B", testEdge("b/web-old", "2020-02-01T00:00:00Z", "2021-03-01T00:00:00Z", 30)),
+		withID("C", testEdge("b/web", "2020-03-01T00:00:00Z", "2021-03-01T00:00:00Z", 40)),
+	)
+	edges, _, err = mergeDownloads([]string{noIDs, ids, renamed})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, e := range edges {
+		got = append(got, fmt.Sprintf("%s %s %d", e.Node.ID, e.Node.NameWithOwner, e.Node.StargazerCount))
+	}
+	want := "A A/DB 10,B b/web-old 30,C b/web 40"
+	if strings.Join(got, ",") != want {
+		t.Fatalf("want %s, got %s", want, strings.Join(got, ","))
+	}
+
+	// a newer copy downloaded without lists keeps the older copy's lists
+	withLists := func(lists []string, edge starredRepositoryEdge) starredRepositoryEdge {
+		edge.Lists = lists
+		return edge
+	}
+	lists := writeTestDownload(t, dir, "lists.jsonl", "2022-01-01T00:00:00Z",
+		withLists([]string{"Databases"}, withID("A", testEdge("a/db", "2020-01-01T00:00:00Z", "2021-01-01T00:00:00Z", 1))),
+		withLists([]string{"Web"}, withID("B", testEdge("b/web", "2020-02-01T00:00:00Z", "2021-01-01T00:00:00Z", 2))),
+	)
+	noLists := writeTestDownload(t, dir, "no-lists.jsonl", "2022-02-01T00:00:00Z",
+		withID("A", testEdge("a/db", "2020-01-01T00:00:00Z", "2021-02-01T00:00:00Z", 10)),
+		// an empty list means the repo was taken out of its lists
+		withLists([]string{}, withID("B", testEdge("b/web", "2020-02-01T00:00:00Z", "2021-02-01T00:00:00Z", 20))),
+	)
+	edges, _, err = mergeDownloads([]string{lists, noLists})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got = nil
+	for _, e := range edges {
+		got = append(got, fmt.Sprintf("%s %d %q", e.Node.NameWithOwner, e.Node.StargazerCount, e.Lists))
+	}
+	want = `a/db 10 ["Databases"],b/web 20 []`
+	if strings.Join(got, ",") != want {
+		t.Fatalf("want %s, got %s", want, strings.Join(got, ","))
+	}
+}
+
+func TestDiffStars(t *testing.T) {
+	oldRepos := []diffRepo{
+		{ID: "1", NameWithOwner: "a/db", StargazerCount: 100},
+		{ID: "2", NameWithOwner: "b/web", StargazerCount: 10},
+		{ID: "", NameWithOwner: "c/cli", Description: "old", StargazerCount: 5},
+		{ID: "4", NameWithOwner: "e/gone", StargazerCount: 1},
+		{ID: "", NameWithOwner: "g/dup", StargazerCount: 1},
+	}
+	newRepos := []diffRepo{
+		{ID: "1", NameWithOwner: "x/db", StargazerCount: 300},
+		{ID: "2", NameWithOwner: "b/web2", StargazerCount: 10},
+		// the old repo has no ID, so it's matched by name, ignoring case
+		{ID: "3", NameWithOwner: "C/CLI", Description: "new", StargazerCount: 6},
+		{ID: "5", NameWithOwner: "f/new", StargazerCount: 1},
+		// only one repo can match each old repo
+		{ID: "7", NameWithOwner: "g/dup", StargazerCount: 1},
+		{ID: "8", NameWithOwner: "G/DUP", StargazerCount: 1},
+	}
+
+	d := diffStars(oldRepos, newRepos, 0)
+	var got []string
+	for _, r := range d.Starred {
+		got = append(got, "starred "+r.NameWithOwner)
+	}
+	for _, r := range d.Unstarred {
+		got = append(got, "unstarred "+r.NameWithOwner)
+	}
+	for _, m := range d.Moved {
+		got = append(got, fmt.Sprintf("moved %s %s %v", m.From, m.To, m.Transferred))
+	}
+	for _, c := range d.Changed {
+		got = append(got, fmt.Sprintf("changed %s %s %v %v", c.NameWithOwner, c.Field, c.Old, c.New))
+	}
+	want := []string{
+		"starred f/new",
+		"starred G/DUP",
+		"unstarred e/gone",
+		"moved b/web b/web2 false",
+		"moved a/db x/db true",
+		"changed C/CLI StargazerCount 5 6",
+		"changed C/CLI Description old new",
+		"changed x/db StargazerCount 100 300",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("want:\n%s\ngot:\n%s", strings.Join(want, "\n"), strings.Join(got, "\n"))
+	}
+
+	// changes smaller than minStarChange aren't reported
+	d = diffStars(oldRepos, newRepos, 100)
+	if len(d.Changed) != 2 || d.Changed[0].Field != "Description" || d.Changed[1].NameWithOwner != "x/db" {
+		t.Fatalf("want the description and x/db's stars, got %+v", d.Changed)
+	}
+
+	// a new repo took a renamed repo's name. The result doesn't depend on
+	// which comes first
+	oldRepos = []diffRepo{{ID: "B", NameWithOwner: "b/web", StargazerCount: 10}}
+	taken := diffRepo{ID: "C", NameWithOwner: "b/web", StargazerCount: 1}
+	renamed := diffRepo{ID: "B", NameWithOwner: "b/web-old", StargazerCount: 10}
+	for _, newRepos := range [][]diffRepo{{taken, renamed}, {renamed, taken}} {
+		d = diffStars(oldRepos, newRepos, 0)
+		if len(d.Starred) != 1 || d.Starred[0].ID != "C" || len(d.Unstarred) != 0 ||
+			len(d.Moved) != 1 || d.Moved[0].To != "b/web-old" || len(d.Changed) != 0 {
+			t.Fatalf("want C starred and B renamed, got %+v", d)
+		}
+	}
+}
+
+func TestLoadDiffReposSqliteWithoutNodeID(t *testing.T) {
+	dsn := filepath.Join(t.TempDir(), "old.db")
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Repo from before node IDs
+	_, err = db.Exec(`
+CREATE TABLE Repo (
+    id INTEGER PRIMARY KEY,
+    NameWithOwner TEXT NOT NULL UNIQUE,
+    Description TEXT,
+    StargazerCount INT NOT NULL
+);
+INSERT INTO Repo (NameWithOwner, Description, StargazerCount) VALUES ('a/db', NULL, 3);
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	repos, err := loadDiffRepos(dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(repos) != 1 || repos[0].ID != "" || repos[0].NameWithOwner != "a/db" || repos[0].StargazerCount != 3 {
+		t.Fatalf("unexpected repos: %+v", repos)
+	}
+
+	// the snapshot isn't migrated
+	db, err = sql.Open("sqlite", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	var tables int
+	err = db.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE type = 'table'`).Scan(&tables)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tables != 1 {
+		t.Fatalf("want only the Repo table, got %d tables", tables)
+	}
+}
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/shurcooL/githubv4"
+	"go.bbkane.com/warg/command"
+)
+
+// mergedEdge is a star and when the file it came from was fetched
+type mergedEdge struct {
+	Edge      starredRepositoryEdge
+	UpdatedAt time.Time
+	FetchedAt time.Time
+}
+
+// newerThan reports whether m has newer data than other: a later UpdatedAt,
+// or the same UpdatedAt from a later download. Ties go to m, so later inputs
+// win
+func (m *mergedEdge) newerThan(other *mergedEdge) bool {
+	if !m.UpdatedAt.Equal(other.UpdatedAt) {
+		return m.UpdatedAt.After(other.UpdatedAt)
+	}
+	return !m.FetchedAt.Before(other.FetchedAt)
+}
+
+// mergeDownloads reads download files, keeping the newest copy of each repo.
+// It returns the stars in the order they were starred and a header
+// describing them all
+func mergeDownloads(inputs []string) ([]starredRepositoryEdge, downloadHeader, error) {
+	merged := downloadHeader{
+		Version:          downloadFormatVersion,
+		StarghazeVersion: getVersion(),
+		FetchedAt:        "",
+		Login:            "",
+		AfterCursor:      nil,
+		IncludeLists:     true,
+		IncludeReadmes:   true,
+		MaxLanguages:     0,
+		MaxRepoTopics:    0,
+		PageSize:         0,
+	}
+	var newestFetch time.Time
+	var edges []*mergedEdge
+	byID := make(map[string]*mergedEdge)
+	byName := make(map[string]*mergedEdge)
+
+	for _, input := range inputs {
+		var fetchedAt time.Time
+		onHeader := func(header *downloadHeader) error {
+			if header == nil {
+				// Files without a header don't say how they were fetched, so
+				// assume the least
+				merged.IncludeLists = false
+				merged.IncludeReadmes = false
+				return nil
+			}
+			if header.Login != "" {
+				if merged.Login != "" && !strings.EqualFold(merged.Login, header.Login) {
+					return fmt.Errorf("can't merge stars of different users: %s and %s", merged.Login, header.Login)
+				}
+				merged.Login = header.Login
+			}
+			if header.FetchedAt != "" {
+				t, err := time.Parse(time.RFC3339, header.FetchedAt)
+				if err != nil {
+					return fmt.Errorf("header FetchedAt parse err: %w", err)
+				}
+				fetchedAt = t
+				if t.After(newestFetch) {
+					newestFetch = t
+					merged.FetchedAt = header.FetchedAt
+				}
+			}
+			merged.IncludeLists = merged.IncludeLists && header.IncludeLists
+			merged.IncludeReadmes = merged.IncludeReadmes && header.IncludeReadmes
+			if header.MaxLanguages > merged.MaxLanguages {
+				merged.MaxLanguages = header.MaxLanguages
+			}
+			if header.MaxRepoTopics > merged.MaxRepoTopics {
+				merged.MaxRepoTopics = header.MaxRepoTopics
+			}
+			return nil
+		}
+		err := readEdges(input, onHeader, func(edge *starredRepositoryEdge) error {
+			// Unparseable dates sort as oldest
+			updatedAt, _ := edge.Node.UpdatedAt.Time()
+			m := &mergedEdge{
+				Edge:      *edge,
+				UpdatedAt: updatedAt,
+				FetchedAt: fetchedAt,
+			}
+			// Repos are matched by node ID, so renamed repos merge and a new
+			// repo with a renamed repo's old name doesn't. Stars from before
+			// node IDs are matched by name
+			name := strings.ToLower(edge.Node.NameWithOwner)
+			var existing *mergedEdge
+			if edge.Node.ID != "" {
+				existing = byID[edge.Node.ID]
+				if e := byName[name]; existing == nil && e != nil && e.Edge.Node.ID == "" {
+					existing = e
+				}
+			} else {
+				existing = byName[name]
+			}
+			switch {
+			case existing == nil:
+				edges = append(edges, m)
+				existing = m
+			case m.newerThan(existing):
+				// keep what the newer copy wasn't downloaded with
+				if m.Edge.Node.ID == "" {
+					m.Edge.Node.ID = existing.Edge.Node.ID
+				}
+				if m.Edge.Lists == nil {
+					m.Edge.Lists = existing.Edge.Lists
+				}
+				*existing = *m
+			}
+			if existing.Edge.Node.ID != "" {
+				byID[existing.Edge.Node.ID] = existing
+			}
+			byName[name] = existing
+			return nil
+		})
+		if err != nil {
+			return nil, merged, fmt.Errorf("%s: %w", input, err)
+		}
+	}
+
+	ret := make([]starredRepositoryEdge, 0, len(edges))
+	for _, m := range edges {
+		ret = append(ret, m.Edge)
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		// RFC 3339 UTC dates sort as strings
+		if ret[i].StarredAt.datetime != ret[j].StarredAt.datetime {
+			return ret[i].StarredAt.datetime < ret[j].StarredAt.datetime
+		}
+		return ret[i].Node.NameWithOwner < ret[j].Node.NameWithOwner
+	})
+	return ret, merged, nil
+}
+
+func merge(ctx command.Context) error {
+	inputs := ctx.Flags["--input"].([]string)
+	outputPath := ctx.Flags["--output"].(string)
+	pageSize := ctx.Flags["--page-size"].(int)
+
+	if pageSize < 1 {
+		return fmt.Errorf("--page-size must be at least 1: %d", pageSize)
+	}
+	absOutput, err := filepath.Abs(outputPath)
+	if err != nil {
+		return fmt.Errorf("output path err: %w", err)
+	}
+	for _, input := range inputs {
+		absInput, err := filepath.Abs(input)
+		if err != nil {
+			return fmt.Errorf("input path err: %w", err)
+		}
+		if absInput == absOutput {
+			return fmt.Errorf("--output can't also be an --input: %s", outputPath)
+		}
+	}
+
+	edges, header, err := mergeDownloads(inputs)
+	if err != nil {
+		return err
+	}
+	header.PageSize = pageSize
+
+	fp, err := os.OpenFile(outputPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0666)
+	if err != nil {
+		return fmt.Errorf("file open err: %w", err)
+	}
+	w, err := compressWriter(outputPath, fp)
+	if err != nil {
+		return err
+	}
+	buf := bufio.NewWriter(w)
+	dw := newDownloadWriter(buf, header)
+
+	// Always write a page, even if empty, so the header gets written
+	var writeErr error
+	for start := 0; writeErr == nil; start += pageSize {
+		end := start + pageSize
+		if end > len(edges) {
+			end = len(edges)
+		}
+		var query Query
+		query.Viewer.Login = header.Login
+		query.Viewer.StarredRepositories.Edges = edges[start:end]
+		query.Viewer.StarredRepositories.PageInfo.HasNextPage = githubv4.Boolean(end < len(edges))
+		writeErr = dw.WritePage(&query)
+		if end == len(edges) {
+			break
+		}
+	}
+	flushErr := buf.Flush()
+	closeErr := w.Close()
+	if writeErr != nil {
+		return writeErr
+	}
+	if flushErr != nil {
+		return fmt.Errorf("file write err: %w", flushErr)
+	}
+	if closeErr != nil {
+		return fmt.Errorf("file close err: %w", closeErr)
+	}
+	fmt.Printf("Merged %d stars from %d files into %s\n", len(edges), len(inputs), outputPath)
+	return nil
+}
@@ -0,0 +1,358 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"time"
+
+	"go.bbkane.com/warg/command"
+	"go.bbkane.com/warg/help"
+)
+
+type savedSearch struct {
+	id            int
+	Name          string
+	Filter        searchFilter
+	CreatedAt     time.Time
+	LastCheckedAt time.Time
+}
+
+func loadSavedSearches(ctx context.Context, db *sql.DB, name string) ([]savedSearch, error) {
+	rows, err := db.QueryContext(
+		ctx,
+		`
+		SELECT id, Name, Term, Language, List, Topic, CreatedAt, LastCheckedAt
+		FROM SavedSearch
+		WHERE ? = '' OR Name = ?
+		ORDER BY Name
+		`,
+		name,
+		name,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error querying saved searches: %w", err)
+	}
+	defer rows.Close()
+
+	var searches []savedSearch
+	for rows.Next() {
+		var s savedSearch
+		err := rows.Scan(
+			&s.id,
+			&s.Name,
+			&s.Filter.Term,
+			&s.Filter.Language,
+			&s.Filter.List,
+			&s.Filter.Topic,
+			(*NullTime)(&s.CreatedAt),
+			(*NullTime)(&s.LastCheckedAt),
+		)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning saved search: %w", err)
+		}
+		searches = append(searches, s)
+	}
+	err = rows.Err()
+	if err != nil {
+		return nil, fmt.Errorf("error at end of scan: %w", err)
+	}
+	if name != "" && len(searches) == 0 {
+		return nil, fmt.Errorf("no saved search named: %s", name)
+	}
+	return searches, nil
+}
+
+// deleteSavedSearch deletes a saved search and its recorded matches. It
+// doesn't rely on ON DELETE CASCADE, as foreign keys are only enabled on the
+// first connection in the pool
+func deleteSavedSearch(ctx context.Context, tx *sql.Tx, name string) (int64, error) {
+	_, err := tx.ExecContext(
+		ctx,
+		`
+		DELETE FROM SavedSearch_Repo
+		WHERE SavedSearch_id IN (SELECT id FROM SavedSearch WHERE Name = ?)
+		`,
+		name,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("saved search match delete err: %w", err)
+	}
+	res, err := tx.ExecContext(ctx, `DELETE FROM SavedSearch WHERE Name = ?`, name)
+	if err != nil {
+		return 0, fmt.Errorf("saved search delete err: %w", err)
+	}
+	deleted, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("rows affected err: %w", err)
+	}
+	return deleted, nil
+}
+
+// markMatchesSeen records results as matches of a saved search and returns
+// the ones that weren't recorded before
+func markMatchesSeen(ctx context.Context, tx *sql.Tx, savedSearchID int, results []searchResult, now time.Time) ([]searchResult, error) {
+	var newResults []searchResult
+	for _, r := range results {
+		res, err := tx.ExecContext(
+			ctx,
+			`
+			INSERT INTO SavedSearch_Repo (
+				SavedSearch_id,
+				Repo_id,
+				FirstMatchedAt
+			)
+			VALUES (?, ?, ?)
+			ON CONFLICT(SavedSearch_id, Repo_id)
+			DO NOTHING
+			`,
+			savedSearchID,
+			r.id,
+			(*NullTime)(&now),
+		)
+		if err != nil {
+			return nil, fmt.Errorf("saved search match insert err: %w", err)
+		}
+		inserted, err := res.RowsAffected()
+		if err != nil {
+			return nil, fmt.Errorf("rows affected err: %w", err)
+		}
+		if inserted > 0 {
+			newResults = append(newResults, r)
+		}
+	}
+	_, err := tx.ExecContext(
+		ctx,
+		`UPDATE SavedSearch SET LastCheckedAt = ? WHERE id = ?`,
+		(*NullTime)(&now),
+		savedSearchID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("saved search update err: %w", err)
+	}
+	return newResults, nil
+}
+
+func searchSave(ctx command.Context) error {
+	dsn := ctx.Flags["--sqlite-dsn"].(string)
+	name := ctx.Flags["--name"].(string)
+	filter := searchFilterFromFlags(ctx)
+
+	db, err := openSqliteDB(dsn)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	// make sure the search works before saving it
+	bgCtx := context.Background()
+	results, err := ftsSearch(bgCtx, db, filter, -1)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	err = withTx(
+		db,
+		func(tx *sql.Tx) error {
+			// Saving over an existing search restarts its match tracking
+			_, err := deleteSavedSearch(bgCtx, tx, name)
+			if err != nil {
+				return err
+			}
+			var id int
+			err = tx.QueryRowContext(
+				bgCtx,
+				`
+				INSERT INTO SavedSearch (
+					Name,
+					Term,
+					Language,
+					List,
+					Topic,
+					CreatedAt
+				)
+				VALUES (?, ?, ?, ?, ?, ?)
+				RETURNING id
+				`,
+				name,
+				filter.Term,
+				filter.Language,
+				filter.List,
+				filter.Topic,
+				(*NullTime)(&now),
+			).Scan(&id)
+			if err != nil {
+				return fmt.Errorf("saved search insert err: %w", err)
+			}
+			// current matches aren't new
+			_, err = markMatchesSeen(bgCtx, tx, id, results, now)
+			return err
+		},
+	)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Saved search %s with %d current matches\n", name, len(results))
+	return nil
+}
+
+func searchList(ctx command.Context) error {
+	dsn := ctx.Flags["--sqlite-dsn"].(string)
+
+	col, err := help.ConditionallyEnableColor(ctx.Flags, os.Stdout)
+	if err != nil {
+		return fmt.Errorf("error enabling color: %w", err)
+	}
+
+	db, err := openSqliteDB(dsn)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	searches, err := loadSavedSearches(context.Background(), db, "")
+	if err != nil {
+		return err
+	}
+	for _, s := range searches {
+		lastChecked := "never"
+		if !s.LastCheckedAt.IsZero() {
+			lastChecked = s.LastCheckedAt.Format(time.RFC3339)
+		}
+		fmt.Println(col.Add(col.Bold, "Name") + ": " + s.Name)
+		fmt.Println(col.Add(col.Bold+col.FgYellowBright, "Term") + ": " + s.Filter.Term)
+		if s.Filter.Language != "" {
+			fmt.Println(col.Add(col.Bold+col.FgCyanBright, "Language") + ": " + s.Filter.Language)
+		}
+		if s.Filter.List != "" {
+			fmt.Println(col.Add(col.Bold+col.FgCyanBright, "List") + ": " + s.Filter.List)
+		}
+		if s.Filter.Topic != "" {
+			fmt.Println(col.Add(col.Bold+col.FgCyanBright, "Topic") + ": " + s.Filter.Topic)
+		}
+		fmt.Println(col.Add(col.Bold+col.FgGreenBright, "LastCheckedAt") + ": " + lastChecked)
+		fmt.Println()
+	}
+	return nil
+}
+
+func searchDelete(ctx command.Context) error {
+	dsn := ctx.Flags["--sqlite-dsn"].(string)
+	name := ctx.Flags["--name"].(string)
+
+	db, err := openSqliteDB(dsn)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	var deleted int64
+	err = withTx(
+		db,
+		func(tx *sql.Tx) error {
+			deleted, err = deleteSavedSearch(context.Background(), tx, name)
+			return err
+		},
+	)
+	if err != nil {
+		return err
+	}
+	if deleted == 0 {
+		return fmt.Errorf("no saved search named: %s", name)
+	}
+	fmt.Printf("Deleted saved search %s\n", name)
+	return nil
+}
+
+func searchRun(ctx command.Context) error {
+	dsn := ctx.Flags["--sqlite-dsn"].(string)
+	name := ctx.Flags["--name"].(string)
+	limit := ctx.Flags["--limit"].(int)
+
+	col, err := help.ConditionallyEnableColor(ctx.Flags, os.Stdout)
+	if err != nil {
+		return fmt.Errorf("error enabling color: %w", err)
+	}
+
+	dates, err := dateFormatFromFlags(ctx.Flags)
+	if err != nil {
+		return err
+	}
+
+	db, err := openSqliteDB(dsn)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	bgCtx := context.Background()
+	searches, err := loadSavedSearches(bgCtx, db, name)
+	if err != nil {
+		return err
+	}
+	results, err := ftsSearch(bgCtx, db, searches[0].Filter, limit)
+	if err != nil {
+		return err
+	}
+	for _, s := range results {
+		printSearchResult(col, s, false, dates)
+	}
+	return nil
+}
+
+// searchNewMatches reports repos matching each saved search that weren't
+// reported before. Run it after each import.
+func searchNewMatches(ctx command.Context) error {
+	dsn := ctx.Flags["--sqlite-dsn"].(string)
+
+	col, err := help.ConditionallyEnableColor(ctx.Flags, os.Stdout)
+	if err != nil {
+		return fmt.Errorf("error enabling color: %w", err)
+	}
+
+	dates, err := dateFormatFromFlags(ctx.Flags)
+	if err != nil {
+		return err
+	}
+
+	db, err := openSqliteDB(dsn)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	bgCtx := context.Background()
+	searches, err := loadSavedSearches(bgCtx, db, "")
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	for _, s := range searches {
+		results, err := ftsSearch(bgCtx, db, s.Filter, -1)
+		if err != nil {
+			return fmt.Errorf("saved search %s: %w", s.Name, err)
+		}
+		var newResults []searchResult
+		err = withTx(
+			db,
+			func(tx *sql.Tx) error {
+				newResults, err = markMatchesSeen(bgCtx, tx, s.id, results, now)
+				return err
+			},
+		)
+		if err != nil {
+			return fmt.Errorf("saved search %s: %w", s.Name, err)
+		}
+		if len(newResults) == 0 {
+			continue
+		}
+		fmt.Printf("%s (%d new)\n\n", col.Add(col.Bold+col.FgGreenBright, s.Name), len(newResults))
+		for _, r := range newResults {
+			printSearchResult(col, r, false, dates)
+		}
+	}
+	return nil
+}
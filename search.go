@@ -5,77 +5,315 @@ import (
 	"database/sql"
 	"fmt"
 	"os"
+	"sort"
 	"strconv"
+	"strings"
+	"time"
 
+	"go.bbkane.com/gocolor"
 	"go.bbkane.com/warg/command"
 	"go.bbkane.com/warg/help"
 	_ "modernc.org/sqlite"
 )
 
 type searchResult struct {
+	id             int
 	Link           string
 	StarredAt      string
 	StargazerCount int
 	Description    string
+	// Score is only set for semantic searches
+	Score float64
+}
+
+// searchFilter narrows a search. Empty fields don't filter
+type searchFilter struct {
+	Term     string
+	Language string
+	List     string
+	Topic    string
+}
+
+// searchFilterSQL restricts the repo id column to repos matching a language,
+// list and topic. Format it with the repo id column, and pass
+// searchFilter.sqlArgs after the other args
+const searchFilterSQL = `
+	AND (? = '' OR %[1]s IN (
+		SELECT lr.Repo_id FROM Language_Repo lr JOIN Language l ON lr.Language_id = l.id
+		WHERE l.Name = ? COLLATE NOCASE
+	))
+	AND (? = '' OR %[1]s IN (
+		SELECT lr.Repo_id FROM List_Repo lr JOIN List l ON lr.List_id = l.id
+		WHERE l.Name = ? COLLATE NOCASE
+	))
+	AND (? = '' OR %[1]s IN (
+		SELECT rt.Repo_id FROM Repo_Topic rt JOIN Topic t ON rt.Topic_id = t.id
+		WHERE t.Name = ? COLLATE NOCASE
+	))
+`
+
+func (f searchFilter) sqlArgs() []interface{} {
+	return []interface{}{f.Language, f.Language, f.List, f.List, f.Topic, f.Topic}
+}
+
+func searchFilterFromFlags(ctx command.Context) searchFilter {
+	term, _ := ctx.Flags["--term"].(string)
+	language, _ := ctx.Flags["--language"].(string)
+	list, _ := ctx.Flags["--list"].(string)
+	topic, _ := ctx.Flags["--topic"].(string)
+	return searchFilter{
+		Term:     term,
+		Language: language,
+		List:     list,
+		Topic:    topic,
+	}
 }
 
 func search(ctx command.Context) error {
 	dsn := ctx.Flags["--sqlite-dsn"].(string)
 	limit := ctx.Flags["--limit"].(int)
-	term := ctx.Flags["--term"].(string)
+	semantic := ctx.Flags["--semantic"].(bool)
+	filter := searchFilterFromFlags(ctx)
 
 	col, err := help.ConditionallyEnableColor(ctx.Flags, os.Stdout)
 	if err != nil {
 		return fmt.Errorf("error enabling color: %w", err)
 	}
 
-	db, err := sql.Open("sqlite", dsn)
+	dates, err := dateFormatFromFlags(ctx.Flags)
 	if err != nil {
-		return fmt.Errorf("db open error: %s: %w", dsn, err)
+		return err
 	}
 
-	query := `
+	db, err := openSqliteDB(dsn)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	var results []searchResult
+	if semantic {
+		results, err = semanticSearch(ctx, db, filter, limit)
+	} else {
+		results, err = ftsSearch(context.Background(), db, filter, limit)
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, s := range results {
+		printSearchResult(col, s, semantic, dates)
+	}
+	return nil
+}
+
+// printSearchResult prints a result. dates formats StarredAt if not nil
+func printSearchResult(col gocolor.Color, s searchResult, showScore bool, dates *dateFormat) {
+	fmt.Println(col.Add(col.Bold, "Link") + ": " + s.Link)
+	fmt.Println(col.Add(col.Bold+col.FgGreenBright, "StarredAt") + ": " + formatRFC3339(dates, s.StarredAt))
+	fmt.Println(col.Add(col.Bold+col.FgCyanBright, "StargazerCount") + ": " + strconv.Itoa(s.StargazerCount))
+	fmt.Println(col.Add(col.Bold+col.FgYellowBright, "Description") + ": " + s.Description)
+	if showScore {
+		fmt.Println(col.Add(col.Bold+col.FgMagentaBright, "Score") + ": " + strconv.FormatFloat(s.Score, 'f', 3, 64))
+	}
+	fmt.Println()
+}
+
+// ftsSearch runs a full text search over repos, their annotations, and their
+// previous names. A negative limit returns all matches.
+func ftsSearch(ctx context.Context, db *sql.DB, filter searchFilter, limit int) ([]searchResult, error) {
+	// Annotations and old names are only searched for unqualified terms, as
+	// their tables don't have Repo_fts's columns
+	args := []interface{}{filter.Term}
+	otherArms := ""
+	if !ftsHasColumnFilter(filter.Term) {
+		otherArms = `
+	  UNION ALL
+	  SELECT a.Repo_id, af.rank
+	  FROM RepoAnnotation_fts af JOIN RepoAnnotation a ON a.id = af.rowid
+	  WHERE RepoAnnotation_fts MATCH ?
+	  UNION ALL
+	  SELECT a.Repo_id, af.rank
+	  FROM RepoAlias_fts af JOIN RepoAlias a ON a.id = af.rowid
+	  WHERE RepoAlias_fts MATCH ?`
+		args = append(args, filter.Term, filter.Term)
+	}
+	query := fmt.Sprintf(`
   SELECT
-	'https://github.com/' || NameWithOwner AS link,
-	StarredAt,
-	StargazerCount,
+	r.id,
+	'https://github.com/' || r.NameWithOwner AS link,
+	r.StarredAt,
+	r.StargazerCount,
 	CASE
-	  WHEN Description = '' THEN SUBSTR(Readme, 0, 50) || '...'
-	  ELSE Description
+	  WHEN r.Description = '' THEN SUBSTR(r.Readme, 0, 50) || '...'
+	  ELSE r.Description
 	END AS Description
   FROM
-	Repo_fts
+	(
+	  SELECT rowid AS Repo_id, rank FROM Repo_fts WHERE Repo_fts MATCH ?
+	  %s
+	) m
+	JOIN Repo r ON r.id = m.Repo_id
   WHERE
-	Repo_fts MATCH ?
+	1 = 1
+	%s
+  GROUP BY
+	r.id
   ORDER BY
-	RANK
+	MIN(m.rank)
   LIMIT
 	?
-`
+`, otherArms, fmt.Sprintf(searchFilterSQL, "r.id"))
 
-	rows, err := db.QueryContext(context.Background(), query, term, limit)
+	args = append(args, filter.sqlArgs()...)
+	args = append(args, limit)
+	rows, err := db.QueryContext(ctx, query, args...)
 	if err != nil {
-		return fmt.Errorf("error querying: %w", err)
+		return nil, fmt.Errorf("error querying: %w", err)
 	}
 	defer rows.Close()
 
-	var s searchResult
+	var results []searchResult
 	for rows.Next() {
-		err := rows.Scan(&s.Link, &s.StarredAt, &s.StargazerCount, &s.Description)
+		var s searchResult
+		err := rows.Scan(&s.id, &s.Link, &s.StarredAt, &s.StargazerCount, &s.Description)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning result: %w", err)
+		}
+		results = append(results, s)
+	}
+	err = rows.Err()
+	if err != nil {
+		return nil, fmt.Errorf("error at end of scan: %w", err)
+	}
+	return results, nil
+}
+
+// ftsHasColumnFilter reports whether an FTS5 query restricts any phrase to
+// columns, like "Description:rust" or "{Description Readme}: x". Outside of
+// strings, FTS5 only uses ':' for column filters
+func ftsHasColumnFilter(term string) bool {
+	inString := false
+	for _, c := range term {
+		switch {
+		case c == '"':
+			inString = !inString
+		case c == ':' && !inString:
+			return true
+		}
+	}
+	return false
+}
+
+// ftsQuoteWords turns text into an FTS5 query matching any of its words, so
+// punctuation like "c++" or "lib?" isn't parsed as FTS5 syntax
+func ftsQuoteWords(text string) string {
+	words := strings.Fields(text)
+	for i := range words {
+		words[i] = `"` + strings.ReplaceAll(words[i], `"`, `""`) + `"`
+	}
+	return strings.Join(words, " OR ")
+}
+
+// semanticSearch ranks every embedded repo by cosine similarity to the term.
+// If --fts-weight is positive, the similarity is blended with the repo's
+// position in the full text search results.
+func semanticSearch(ctx command.Context, db *sql.DB, filter searchFilter, limit int) ([]searchResult, error) {
+	timeout := ctx.Flags["--timeout"].(time.Duration)
+	ftsWeightPercent := ctx.Flags["--fts-weight"].(int)
+	embedURL := ctx.Flags["--embed-url"].(string)
+	embedModel := ctx.Flags["--embed-model"].(string)
+	embedAPIKey, _ := ctx.Flags["--embed-api-key"].(string)
+
+	if ftsWeightPercent < 0 || ftsWeightPercent > 100 {
+		return nil, fmt.Errorf("--fts-weight must be between 0 and 100: %d", ftsWeightPercent)
+	}
+	ftsWeight := float64(ftsWeightPercent) / 100
+
+	timeCtx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	var embedder Embedder = NewOpenAIEmbedder(embedURL, embedModel, embedAPIKey)
+	vecs, err := embedder.Embed(timeCtx, []string{filter.Term})
+	if err != nil {
+		return nil, fmt.Errorf("term embed err: %w", err)
+	}
+	termVec := vecs[0]
+
+	// FTS position score: 1 for the best match, falling towards 0
+	ftsScores := make(map[int]float64)
+	if ftsWeight > 0 {
+		// --term is natural language here, not FTS5 query syntax
+		ftsFilter := filter
+		ftsFilter.Term = ftsQuoteWords(filter.Term)
+		// look a little past limit so blending can promote FTS matches
+		ftsResults, err := ftsSearch(timeCtx, db, ftsFilter, limit*4)
 		if err != nil {
-			return fmt.Errorf("error scanning result: %w", err)
+			return nil, err
+		}
+		for i := range ftsResults {
+			ftsScores[ftsResults[i].id] = 1 - float64(i)/float64(len(ftsResults))
 		}
+	}
 
-		fmt.Println(col.Add(col.Bold, "Link") + ": " + s.Link)
-		fmt.Println(col.Add(col.Bold+col.FgGreenBright, "StarredAt") + ": " + s.StarredAt)
-		fmt.Println(col.Add(col.Bold+col.FgCyanBright, "StargazerCount") + ": " + strconv.Itoa(s.StargazerCount))
-		fmt.Println(col.Add(col.Bold+col.FgYellowBright, "Description") + ": " + s.Description)
-		fmt.Println()
+	query := fmt.Sprintf(`
+  SELECT
+	r.id,
+	'https://github.com/' || r.NameWithOwner AS link,
+	r.StarredAt,
+	r.StargazerCount,
+	CASE
+	  WHEN r.Description = '' THEN SUBSTR(r.Readme, 0, 50) || '...'
+	  ELSE r.Description
+	END AS Description,
+	e.Embedding
+  FROM
+	RepoEmbedding e
+	JOIN Repo r ON e.Repo_id = r.id
+  WHERE
+	e.Model = ?
+	%s
+`, fmt.Sprintf(searchFilterSQL, "r.id"))
+
+	args := []interface{}{embedder.Model()}
+	args = append(args, filter.sqlArgs()...)
+	rows, err := db.QueryContext(timeCtx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("error querying embeddings: %w", err)
+	}
+	defer rows.Close()
+
+	var results []searchResult
+	for rows.Next() {
+		var s searchResult
+		var description sql.NullString
+		var blob []byte
+		err := rows.Scan(&s.id, &s.Link, &s.StarredAt, &s.StargazerCount, &description, &blob)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning result: %w", err)
+		}
+		s.Description = description.String
+		vec, err := decodeVector(blob)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", s.Link, err)
+		}
+		s.Score = (1-ftsWeight)*cosineSimilarity(termVec, vec) + ftsWeight*ftsScores[s.id]
+		results = append(results, s)
 	}
 	err = rows.Err()
 	if err != nil {
-		return fmt.Errorf("error at end of scan: %w", err)
+		return nil, fmt.Errorf("error at end of scan: %w", err)
+	}
+	if len(results) == 0 {
+		return nil, fmt.Errorf("no embeddings found for model %s. Run `starghaze embed` first", embedder.Model())
 	}
 
-	return nil
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].Score > results[j].Score
+	})
+	// a negative limit means all results, like the full text search's LIMIT
+	if limit >= 0 && len(results) > limit {
+		results = results[:limit]
+	}
+	return results, nil
 }
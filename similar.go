@@ -0,0 +1,273 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"go.bbkane.com/warg/command"
+	"go.bbkane.com/warg/help"
+	_ "modernc.org/sqlite"
+)
+
+// similarRepo holds everything we compare repos on
+type similarRepo struct {
+	id            int
+	NameWithOwner string
+	Description   string
+	topics        map[int]bool
+	// language name -> bytes of code
+	languages map[string]float64
+	// term -> normalized tf-idf weight
+	terms map[string]float64
+}
+
+type similarity struct {
+	repo     *similarRepo
+	Score    float64
+	Topic    float64
+	Language float64
+	Text     float64
+}
+
+// stopWords are too common in READMEs to say anything about similarity
+var stopWords = map[string]bool{
+	"a": true, "an": true, "and": true, "are": true, "as": true, "at": true,
+	"be": true, "by": true, "can": true, "for": true, "from": true, "has": true,
+	"have": true, "if": true, "in": true, "is": true, "it": true, "its": true,
+	"of": true, "on": true, "or": true, "that": true, "the": true, "this": true,
+	"to": true, "was": true, "will": true, "with": true, "you": true, "your": true,
+	"com": true, "github": true, "http": true, "https": true, "www": true,
+}
+
+// tokenize splits text into lowercase words, dropping stop words and
+// single characters
+func tokenize(text string) []string {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	tokens := make([]string, 0, len(words))
+	for _, w := range words {
+		if len(w) < 2 || stopWords[w] {
+			continue
+		}
+		tokens = append(tokens, w)
+	}
+	return tokens
+}
+
+// jaccard is |a ∩ b| / |a ∪ b|
+func jaccard(a map[int]bool, b map[int]bool) float64 {
+	if len(a) == 0 || len(b) == 0 {
+		return 0
+	}
+	intersection := 0
+	for k := range a {
+		if b[k] {
+			intersection++
+		}
+	}
+	return float64(intersection) / float64(len(a)+len(b)-intersection)
+}
+
+// sparseCosine compares two sparse vectors
+func sparseCosine(a map[string]float64, b map[string]float64) float64 {
+	var dot, normA, normB float64
+	for k, v := range a {
+		dot += v * b[k]
+		normA += v * v
+	}
+	for _, v := range b {
+		normB += v * v
+	}
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+	return dot / (math.Sqrt(normA) * math.Sqrt(normB))
+}
+
+// loadSimilarRepos reads every repo with its topics, language sizes and
+// tf-idf weighted description and README terms
+func loadSimilarRepos(db *sql.DB) (map[int]*similarRepo, error) {
+	repos := make(map[int]*similarRepo)
+	texts := make(map[int][]string)
+
+	rows, err := db.Query(`SELECT id, NameWithOwner, COALESCE(Description, ''), COALESCE(Readme, '') FROM Repo`)
+	if err != nil {
+		return nil, fmt.Errorf("error querying repos: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		r := similarRepo{
+			topics:    make(map[int]bool),
+			languages: make(map[string]float64),
+			terms:     make(map[string]float64),
+		}
+		var readme string
+		err := rows.Scan(&r.id, &r.NameWithOwner, &r.Description, &readme)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning repo: %w", err)
+		}
+		repos[r.id] = &r
+		texts[r.id] = tokenize(r.Description + " " + readme)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error at end of repo scan: %w", err)
+	}
+
+	topicRows, err := db.Query(`SELECT Repo_id, Topic_id FROM Repo_Topic`)
+	if err != nil {
+		return nil, fmt.Errorf("error querying topics: %w", err)
+	}
+	defer topicRows.Close()
+	for topicRows.Next() {
+		var repoID, topicID int
+		if err := topicRows.Scan(&repoID, &topicID); err != nil {
+			return nil, fmt.Errorf("error scanning topic: %w", err)
+		}
+		if r, exists := repos[repoID]; exists {
+			r.topics[topicID] = true
+		}
+	}
+	if err := topicRows.Err(); err != nil {
+		return nil, fmt.Errorf("error at end of topic scan: %w", err)
+	}
+
+	langRows, err := db.Query(`
+		SELECT lr.Repo_id, l.Name, lr.Size
+		FROM Language_Repo lr JOIN Language l ON lr.Language_id = l.id
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("error querying languages: %w", err)
+	}
+	defer langRows.Close()
+	for langRows.Next() {
+		var repoID int
+		var langName string
+		var size float64
+		if err := langRows.Scan(&repoID, &langName, &size); err != nil {
+			return nil, fmt.Errorf("error scanning language: %w", err)
+		}
+		if r, exists := repos[repoID]; exists {
+			r.languages[langName] = size
+		}
+	}
+	if err := langRows.Err(); err != nil {
+		return nil, fmt.Errorf("error at end of language scan: %w", err)
+	}
+
+	// tf-idf: term frequency in the repo * log(repos / repos with the term)
+	docFreq := make(map[string]int)
+	for _, tokens := range texts {
+		seen := make(map[string]bool)
+		for _, t := range tokens {
+			if !seen[t] {
+				docFreq[t]++
+				seen[t] = true
+			}
+		}
+	}
+	for id, tokens := range texts {
+		if len(tokens) == 0 {
+			continue
+		}
+		termFreq := make(map[string]int)
+		for _, t := range tokens {
+			termFreq[t]++
+		}
+		for t, tf := range termFreq {
+			idf := math.Log(float64(len(repos)) / float64(docFreq[t]))
+			repos[id].terms[t] = float64(tf) / float64(len(tokens)) * idf
+		}
+	}
+	return repos, nil
+}
+
+func similar(ctx command.Context) error {
+	dsn := ctx.Flags["--sqlite-dsn"].(string)
+	limit := ctx.Flags["--limit"].(int)
+	nameWithOwner := ctx.Flags["--repo"].(string)
+	topicWeight := ctx.Flags["--topic-weight"].(int)
+	languageWeight := ctx.Flags["--language-weight"].(int)
+	textWeight := ctx.Flags["--text-weight"].(int)
+
+	totalWeight := topicWeight + languageWeight + textWeight
+	if topicWeight < 0 || languageWeight < 0 || textWeight < 0 || totalWeight == 0 {
+		return fmt.Errorf("weights must not be negative and at least one must be positive")
+	}
+	if limit < 0 {
+		return fmt.Errorf("--limit must not be negative: %d", limit)
+	}
+
+	col, err := help.ConditionallyEnableColor(ctx.Flags, os.Stdout)
+	if err != nil {
+		return fmt.Errorf("error enabling color: %w", err)
+	}
+
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return fmt.Errorf("db open error: %s: %w", dsn, err)
+	}
+	defer db.Close()
+
+	repos, err := loadSimilarRepos(db)
+	if err != nil {
+		return err
+	}
+
+	var target *similarRepo
+	for _, r := range repos {
+		if strings.EqualFold(r.NameWithOwner, nameWithOwner) {
+			target = r
+			break
+		}
+	}
+	if target == nil {
+		return fmt.Errorf("repo not found in %s: %s", dsn, nameWithOwner)
+	}
+
+	var sims []similarity
+	for _, r := range repos {
+		if r.id == target.id {
+			continue
+		}
+		s := similarity{
+			repo:     r,
+			Topic:    jaccard(target.topics, r.topics),
+			Language: sparseCosine(target.languages, r.languages),
+			Text:     sparseCosine(target.terms, r.terms),
+		}
+		s.Score = (float64(topicWeight)*s.Topic +
+			float64(languageWeight)*s.Language +
+			float64(textWeight)*s.Text) / float64(totalWeight)
+		sims = append(sims, s)
+	}
+	sort.Slice(sims, func(i, j int) bool {
+		if sims[i].Score != sims[j].Score {
+			return sims[i].Score > sims[j].Score
+		}
+		return sims[i].repo.NameWithOwner < sims[j].repo.NameWithOwner
+	})
+	if len(sims) > limit {
+		sims = sims[:limit]
+	}
+
+	formatScore := func(f float64) string {
+		return strconv.FormatFloat(f, 'f', 3, 64)
+	}
+	for _, s := range sims {
+		fmt.Println(col.Add(col.Bold, "Link") + ": " + "https://github.com/" + s.repo.NameWithOwner)
+		fmt.Println(col.Add(col.Bold+col.FgMagentaBright, "Score") + ": " + formatScore(s.Score) +
+			" (topics " + formatScore(s.Topic) +
+			", languages " + formatScore(s.Language) +
+			", text " + formatScore(s.Text) + ")")
+		fmt.Println(col.Add(col.Bold+col.FgYellowBright, "Description") + ": " + s.repo.Description)
+		fmt.Println()
+	}
+	return nil
+}
@@ -0,0 +1,11 @@
+-- Vectors for semantic search. Embedding is little-endian float32s.
+-- ContentHash lets `starghaze embed` skip repos whose text hasn't changed.
+CREATE TABLE RepoEmbedding (
+    Repo_id INTEGER NOT NULL,
+    Model TEXT NOT NULL,
+    ContentHash TEXT NOT NULL,
+    Dimensions INTEGER NOT NULL,
+    Embedding BLOB NOT NULL,
+    FOREIGN KEY (Repo_id) REFERENCES Repo(id) ON DELETE CASCADE,
+    PRIMARY KEY (Repo_id, Model)
+) STRICT;
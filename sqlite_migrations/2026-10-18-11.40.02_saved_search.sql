@@ -0,0 +1,23 @@
+-- Named searches saved with `starghaze search save`. Empty Language and
+-- Topic don't filter.
+CREATE TABLE SavedSearch (
+    id INTEGER PRIMARY KEY NOT NULL,
+    Name TEXT NOT NULL,
+    Term TEXT NOT NULL,
+    Language TEXT NOT NULL,
+    Topic TEXT NOT NULL,
+    CreatedAt TEXT NOT NULL,
+    LastCheckedAt TEXT,
+    UNIQUE(Name)
+) STRICT;
+
+-- Repos already reported for a saved search, so
+-- `starghaze search new-matches` only reports each match once.
+CREATE TABLE SavedSearch_Repo (
+    SavedSearch_id INTEGER NOT NULL,
+    Repo_id INTEGER NOT NULL,
+    FirstMatchedAt TEXT NOT NULL,
+    FOREIGN KEY (SavedSearch_id) REFERENCES SavedSearch(id) ON DELETE CASCADE,
+    FOREIGN KEY (Repo_id) REFERENCES Repo(id) ON DELETE CASCADE,
+    PRIMARY KEY (SavedSearch_id, Repo_id)
+) STRICT;
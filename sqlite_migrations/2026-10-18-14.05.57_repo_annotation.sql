@@ -0,0 +1,69 @@
+-- Notes, tags, ratings etc. imported from Google Sheets with
+-- `starghaze gsheets download`. Name is the sheet column name.
+CREATE TABLE RepoAnnotation (
+    id INTEGER PRIMARY KEY NOT NULL,
+    Repo_id INTEGER NOT NULL,
+    Name TEXT NOT NULL,
+    Value TEXT NOT NULL,
+    UpdatedAt TEXT NOT NULL,
+    FOREIGN KEY (Repo_id) REFERENCES Repo(id) ON DELETE CASCADE,
+    UNIQUE(Repo_id, Name)
+) STRICT;
+
+CREATE VIRTUAL TABLE RepoAnnotation_fts USING fts5(
+    -- indexed fields
+    Value,
+    -- unindexed fields
+    Name UNINDEXED,
+    -- special args
+    content='RepoAnnotation',
+    content_rowid='id'
+);
+
+-- Triggers to keep the FTS index up to date.
+CREATE TRIGGER RepoAnnotation_ai AFTER INSERT ON RepoAnnotation BEGIN
+    INSERT INTO RepoAnnotation_fts(
+        rowid,
+        Value,
+        Name
+    ) VALUES (
+        new.id,
+        new.Value,
+        new.Name
+    );
+END;
+CREATE TRIGGER RepoAnnotation_ad AFTER DELETE ON RepoAnnotation BEGIN
+    INSERT INTO RepoAnnotation_fts(
+        RepoAnnotation_fts,
+        rowid,
+        Value,
+        Name
+    ) VALUES (
+        'delete',
+        old.id,
+        old.Value,
+        old.Name
+    );
+END;
+CREATE TRIGGER RepoAnnotation_au AFTER UPDATE ON RepoAnnotation BEGIN
+    INSERT INTO RepoAnnotation_fts(
+        RepoAnnotation_fts,
+        rowid,
+        Value,
+        Name
+    ) VALUES (
+        'delete',
+        old.id,
+        old.Value,
+        old.Name
+    );
+    INSERT INTO RepoAnnotation_fts(
+        rowid,
+        Value,
+        Name
+    ) VALUES (
+        new.id,
+        new.Value,
+        new.Name
+    );
+END;
@@ -0,0 +1,65 @@
+-- GitHub node IDs survive renames and transfers, unlike NameWithOwner, so
+-- `starghaze format --format sqlite` matches repos on NodeID. Repos formatted
+-- before this migration have NULL IDs until they're formatted again.
+ALTER TABLE Repo ADD COLUMN NodeID TEXT;
+ALTER TABLE Repo ADD COLUMN DatabaseID INTEGER;
+CREATE UNIQUE INDEX Repo_NodeID ON Repo(NodeID);
+
+-- Previous names of renamed or transferred repos. RenamedAt is when
+-- starghaze noticed the rename.
+CREATE TABLE RepoAlias (
+    id INTEGER PRIMARY KEY NOT NULL,
+    Repo_id INTEGER NOT NULL,
+    NameWithOwner TEXT NOT NULL,
+    RenamedAt TEXT NOT NULL,
+    FOREIGN KEY (Repo_id) REFERENCES Repo(id) ON DELETE CASCADE,
+    UNIQUE(NameWithOwner)
+) STRICT;
+
+CREATE VIRTUAL TABLE RepoAlias_fts USING fts5(
+    -- indexed fields
+    NameWithOwner,
+    -- special args
+    content='RepoAlias',
+    content_rowid='id'
+);
+
+-- Triggers to keep the FTS index up to date.
+CREATE TRIGGER RepoAlias_ai AFTER INSERT ON RepoAlias BEGIN
+    INSERT INTO RepoAlias_fts(
+        rowid,
+        NameWithOwner
+    ) VALUES (
+        new.id,
+        new.NameWithOwner
+    );
+END;
+CREATE TRIGGER RepoAlias_ad AFTER DELETE ON RepoAlias BEGIN
+    INSERT INTO RepoAlias_fts(
+        RepoAlias_fts,
+        rowid,
+        NameWithOwner
+    ) VALUES (
+        'delete',
+        old.id,
+        old.NameWithOwner
+    );
+END;
+CREATE TRIGGER RepoAlias_au AFTER UPDATE ON RepoAlias BEGIN
+    INSERT INTO RepoAlias_fts(
+        RepoAlias_fts,
+        rowid,
+        NameWithOwner
+    ) VALUES (
+        'delete',
+        old.id,
+        old.NameWithOwner
+    );
+    INSERT INTO RepoAlias_fts(
+        rowid,
+        NameWithOwner
+    ) VALUES (
+        new.id,
+        new.NameWithOwner
+    );
+END;
@@ -0,0 +1,17 @@
+-- The viewer's GitHub Lists, from downloads made with --include-lists.
+CREATE TABLE List (
+    id INTEGER PRIMARY KEY NOT NULL,
+    Name TEXT NOT NULL,
+    UNIQUE(Name)
+) STRICT;
+
+CREATE TABLE List_Repo (
+    List_id INTEGER NOT NULL,
+    Repo_id INTEGER NOT NULL,
+    FOREIGN KEY (List_id) REFERENCES List(id) ON DELETE CASCADE,
+    FOREIGN KEY (Repo_id) REFERENCES Repo(id) ON DELETE CASCADE,
+    PRIMARY KEY (List_id, Repo_id)
+) STRICT;
+
+-- Empty List doesn't filter, like Language and Topic.
+ALTER TABLE SavedSearch ADD COLUMN List TEXT NOT NULL DEFAULT '';
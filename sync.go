@@ -0,0 +1,360 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/lestrrat-go/strftime"
+	"go.bbkane.com/warg/command"
+)
+
+// syncSink is somewhere sync writes stars. Sinks with a printer get every
+// star; archive sinks get every downloaded page
+type syncSink struct {
+	Name    string
+	printer Printer
+	archive *downloadWriter
+	// finish runs after a successful download, to close files and upload
+	finish func(ctx context.Context) error
+	// cleanup releases resources if the download fails
+	cleanup func()
+	written int
+	err     error
+}
+
+// parseSinks splits --sink values into kind and path. Each value may hold
+// several comma separated sinks, as config lists arrive that way
+func parseSinks(values []string) ([][2]string, error) {
+	var sinks [][2]string
+	for _, value := range values {
+		for _, sink := range strings.Split(value, ",") {
+			sink = strings.TrimSpace(sink)
+			if sink == "" {
+				continue
+			}
+			kind, path, _ := strings.Cut(sink, ":")
+			sinks = append(sinks, [2]string{kind, path})
+		}
+	}
+	if len(sinks) == 0 {
+		return nil, fmt.Errorf("pass at least one --sink")
+	}
+	return sinks, nil
+}
+
+// fileSink opens path for a printer, flushing and closing it in finish
+func fileSink(name string, path string, newPrinter func(*bufio.Writer) Printer) (*syncSink, error) {
+	fp, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("file open err: %w", err)
+	}
+	buf := bufio.NewWriter(fp)
+	return &syncSink{
+		Name:    name,
+		printer: newPrinter(buf),
+		finish: func(ctx context.Context) error {
+			err := buf.Flush()
+			if err != nil {
+				fp.Close()
+				return fmt.Errorf("file write err: %w", err)
+			}
+			return fp.Close()
+		},
+		cleanup: func() {
+			fp.Close()
+		},
+	}, nil
+}
+
+// zincUpload posts a bulk request to Zinc
+// https://docs.zincsearch.com/api/document/bulk/
+func zincUpload(ctx context.Context, zincURL string, user string, password string, body []byte) error {
+	req, err := http.NewRequestWithContext(
+		ctx,
+		http.MethodPost,
+		strings.TrimSuffix(zincURL, "/")+"/api/_bulk",
+		bytes.NewReader(body),
+	)
+	if err != nil {
+		return fmt.Errorf("zinc request err: %w", err)
+	}
+	req.SetBasicAuth(user, password)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("zinc upload err: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("zinc upload status: %s", resp.Status)
+	}
+	return nil
+}
+
+// newSyncSink builds a sink from its kind and optional path. opts are
+// recorded in jsonl archive headers
+func newSyncSink(ctx command.Context, opts downloadOptions, kind string, path string) (*syncSink, error) {
+	name := kind
+	if path != "" {
+		name += ":" + path
+	}
+	needsPath := func() error {
+		if path == "" {
+			return fmt.Errorf("sink %s needs a path: %s:PATH", kind, kind)
+		}
+		return nil
+	}
+
+	switch kind {
+	case "csv":
+		if err := needsPath(); err != nil {
+			return nil, err
+		}
+		return fileSink(name, path, func(w *bufio.Writer) Printer { return NewCSVPrinter(w, csvOptions{}) })
+
+	case "jsonl":
+		if err := needsPath(); err != nil {
+			return nil, err
+		}
+		// the path can be a strftime pattern to keep dated archives
+		archivePath, err := strftime.Format(path, time.Now())
+		if err != nil {
+			return nil, fmt.Errorf("jsonl path format err: %w", err)
+		}
+		fp, err := os.Create(archivePath)
+		if err != nil {
+			return nil, fmt.Errorf("file open err: %w", err)
+		}
+		w, err := compressWriter(archivePath, fp)
+		if err != nil {
+			return nil, err
+		}
+		buf := bufio.NewWriter(w)
+		return &syncSink{
+			Name:    "jsonl:" + archivePath,
+			archive: newDownloadWriter(buf, downloadHeaderFromOptions(opts)),
+			finish: func(ctx context.Context) error {
+				err := buf.Flush()
+				if err != nil {
+					w.Close()
+					return fmt.Errorf("file write err: %w", err)
+				}
+				return w.Close()
+			},
+			cleanup: func() {
+				w.Close()
+			},
+		}, nil
+
+	case "sqlite":
+		sqliteDSN := ctx.Flags["--sqlite-dsn"].(string)
+		if path != "" {
+			sqliteDSN = path
+			name = "sqlite:" + path
+		}
+		p, err := NewSqlitePrinter(sqliteDSN, "")
+		if err != nil {
+			return nil, fmt.Errorf("sql open err: %w", err)
+		}
+		return &syncSink{
+			Name:    name,
+			printer: p,
+			finish: func(ctx context.Context) error {
+				return p.Flush()
+			},
+			cleanup: func() {
+				_ = p.tx.Rollback()
+				p.db.Close()
+			},
+		}, nil
+
+	case "zinc":
+		zincIndexName := ctx.Flags["--zinc-index-name"].(string)
+		zincURL, zincURLExists := ctx.Flags["--zinc-url"].(string)
+		zincUser, _ := ctx.Flags["--zinc-user"].(string)
+		zincPassword, _ := ctx.Flags["--zinc-password"].(string)
+		if path == "" && !zincURLExists {
+			return nil, fmt.Errorf("sink zinc needs a path (zinc:PATH), --zinc-url, or both")
+		}
+		var buf bytes.Buffer
+		return &syncSink{
+			Name:    name,
+			printer: NewZincPrinter(&buf, zincIndexName),
+			finish: func(ctx context.Context) error {
+				if path != "" {
+					err := os.WriteFile(path, buf.Bytes(), 0666)
+					if err != nil {
+						return fmt.Errorf("file write err: %w", err)
+					}
+				}
+				if zincURLExists {
+					return zincUpload(ctx, zincURL, zincUser, zincPassword, buf.Bytes())
+				}
+				return nil
+			},
+			cleanup: func() {},
+		}, nil
+
+	case "gsheets":
+		credentialsFile, _ := ctx.Flags["--credentials-file"].(string)
+		gsheetsSync := ctx.Flags["--gsheets-sync"].(bool)
+		spreadsheetId, err := spreadsheetIDFromFlags(ctx)
+		if err != nil {
+			return nil, err
+		}
+		sheetID, sheetIDExists, sheetName, err := sheetTargetFromFlags(ctx)
+		if err != nil {
+			return nil, err
+		}
+		// The printer gets dates with the date format flags applied, so check
+		// Sheets can show them before downloading
+		dateFormats, err := parseDateFormats(ctx.Flags)
+		if err != nil {
+			return nil, err
+		}
+		for _, f := range []*dateFormat{dateFormats.StarredAt, dateFormats.PushedAt, dateFormats.UpdatedAt} {
+			if _, err := sheetsDateFormat(f, ""); err != nil {
+				return nil, fmt.Errorf("date format error: %w", err)
+			}
+		}
+		p := NewSheetsPrinter(`yyyy-mm-dd"T"hh:mm:ss"Z"`)
+		return &syncSink{
+			Name:    name,
+			printer: p,
+			finish: func(ctx context.Context) error {
+				srv, err := newSheetsService(ctx, credentialsFile)
+				if err != nil {
+					return err
+				}
+				sheetProps, err := findOrAddSheet(ctx, srv, spreadsheetId, sheetID, sheetIDExists, sheetName)
+				if err != nil {
+					return err
+				}
+				if sheetProps.GridProperties == nil {
+					return fmt.Errorf("can't upload to non-grid sheet: %s", sheetProps.Title)
+				}
+				rows := p.Rows()
+				if gsheetsSync {
+					return gSheetsSync(ctx, srv, spreadsheetId, sheetProps, rows)
+				}
+				return gSheetsOverwrite(
+					ctx,
+					srv,
+					spreadsheetId,
+					sheetProps,
+					sheetsRowsWriteRequest(sheetProps.SheetId, rows),
+					len(rows),
+					len(csvColumns),
+					sheetLayout{},
+				)
+			},
+			cleanup: func() {},
+		}, nil
+
+	default:
+		return nil, fmt.Errorf("unknown sink: %s. Use sqlite[:DSN], csv:PATH, jsonl:PATH, zinc[:PATH] or gsheets", kind)
+	}
+}
+
+// syncStars downloads stars and streams them into every --sink at once. A
+// sink that fails doesn't stop the others
+func syncStars(ctx command.Context) error {
+	sinkValues := ctx.Flags["--sink"].([]string)
+	timeout := ctx.Flags["--timeout"].(time.Duration)
+	opts := downloadOptionsFromFlags(ctx)
+
+	dateFormats, err := parseDateFormats(ctx.Flags)
+	if err != nil {
+		return err
+	}
+
+	parsed, err := parseSinks(sinkValues)
+	if err != nil {
+		return err
+	}
+	var sinks []*syncSink
+	cleanup := func() {
+		for _, s := range sinks {
+			s.cleanup()
+		}
+	}
+	for _, kindPath := range parsed {
+		s, err := newSyncSink(ctx, opts, kindPath[0], kindPath[1])
+		if err != nil {
+			cleanup()
+			return fmt.Errorf("sink %s: %w", kindPath[0], err)
+		}
+		sinks = append(sinks, s)
+	}
+
+	for _, s := range sinks {
+		if s.printer != nil {
+			s.err = s.printer.Header()
+		}
+	}
+
+	timeCtx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	pages := 0
+	stars := 0
+	err = downloadPages(timeCtx, opts, func(query *Query) error {
+		pages++
+		// archive before setting date formats so archives match download
+		for _, s := range sinks {
+			if s.archive != nil && s.err == nil {
+				s.err = s.archive.WritePage(query)
+				if s.err == nil {
+					s.written++
+				}
+			}
+		}
+		for i := range query.Viewer.StarredRepositories.Edges {
+			edge := &query.Viewer.StarredRepositories.Edges[i]
+			dateFormats.apply(edge)
+			stars++
+			for _, s := range sinks {
+				if s.printer != nil && s.err == nil {
+					s.err = s.printer.Line(edge)
+					if s.err == nil {
+						s.written++
+					}
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		cleanup()
+		return fmt.Errorf("download err after %d pages: %w", pages, err)
+	}
+
+	failed := 0
+	fmt.Printf("Downloaded %d stars in %d pages\n", stars, pages)
+	for _, s := range sinks {
+		if s.err == nil {
+			s.err = s.finish(timeCtx)
+		} else {
+			s.cleanup()
+		}
+		if s.err != nil {
+			failed++
+			fmt.Printf("%s: FAILED: %s\n", s.Name, s.err)
+			continue
+		}
+		unit := "stars"
+		if s.archive != nil {
+			unit = "pages"
+		}
+		fmt.Printf("%s: wrote %d %s\n", s.Name, s.written, unit)
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d sinks failed", failed, len(sinks))
+	}
+	return nil
+}
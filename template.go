@@ -0,0 +1,129 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/lestrrat-go/strftime"
+)
+
+// -- TemplatePrinter
+
+// templateFuncs are the helper functions --template-file can use
+var templateFuncs = template.FuncMap{
+	// ago prints a date like "3 months ago": {{ ago .StarredAt }}
+	"ago": func(d formattedDate) (string, error) {
+		if d.datetime == "" {
+			return "", nil
+		}
+		t, err := d.Time()
+		if err != nil {
+			return "", err
+		}
+		return relativeTime(t, time.Now()), nil
+	},
+	// date formats a date with a strftime pattern, in --timezone if passed:
+	// {{ date "%Y-%m-%d" .StarredAt }}
+	"date": func(pattern string, d formattedDate) (string, error) {
+		if d.datetime == "" {
+			return "", nil
+		}
+		t, err := d.Time()
+		if err != nil {
+			return "", err
+		}
+		if d.Format != nil && d.Format.Location != nil {
+			t = t.In(d.Format.Location)
+		}
+		return strftime.Format(pattern, t)
+	},
+	// join joins a list: {{ join ", " (languages .) }}
+	"join": func(sep string, list []string) string {
+		return strings.Join(list, sep)
+	},
+	// json marshals a value, for data files: {{ json .Node.Description }}
+	"json": func(v interface{}) (string, error) {
+		b, err := json.Marshal(v)
+		if err != nil {
+			return "", err
+		}
+		return string(b), nil
+	},
+	"languages":   edgeLanguages,
+	"topLanguage": topLanguage,
+	"topics":      edgeTopics,
+	// truncate shortens a string to n characters: {{ truncate 80 .Node.Description }}
+	"truncate": func(n int, s string) string {
+		return truncateChars(s, n)
+	},
+}
+
+// templateFooter is the data the footer template gets
+type templateFooter struct {
+	Count int
+}
+
+// TemplatePrinter executes a text/template for each star. If the template
+// defines "header" or "footer" templates, they're executed once before and
+// after the stars
+type TemplatePrinter struct {
+	w     io.Writer
+	tmpl  *template.Template
+	count int
+}
+
+// NewTemplatePrinter parses the template at path
+func NewTemplatePrinter(w io.Writer, path string) (*TemplatePrinter, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("can't read template: %w", err)
+	}
+	tmpl, err := template.New(filepath.Base(path)).Funcs(templateFuncs).Parse(string(b))
+	if err != nil {
+		return nil, fmt.Errorf("can't parse template: %w", err)
+	}
+	return &TemplatePrinter{
+		w:     w,
+		tmpl:  tmpl,
+		count: 0,
+	}, nil
+}
+
+func (p *TemplatePrinter) Header() error {
+	if p.tmpl.Lookup("header") == nil {
+		return nil
+	}
+	err := p.tmpl.ExecuteTemplate(p.w, "header", nil)
+	if err != nil {
+		return fmt.Errorf("header template err: %w", err)
+	}
+	return nil
+}
+
+func (p *TemplatePrinter) Line(sr *starredRepositoryEdge) error {
+	err := p.tmpl.Execute(p.w, sr)
+	if err != nil {
+		return fmt.Errorf("template err: %w", err)
+	}
+	p.count++
+	return nil
+}
+
+func (p *TemplatePrinter) Flush() error {
+	if p.tmpl.Lookup("footer") == nil {
+		return nil
+	}
+	err := p.tmpl.ExecuteTemplate(p.w, "footer", templateFooter{Count: p.count})
+	if err != nil {
+		return fmt.Errorf("footer template err: %w", err)
+	}
+	return nil
+}
+
+var _ Printer = new(TemplatePrinter)